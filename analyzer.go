@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// Metadata keys set by the image analyzer.
+const (
+	MetadataWidth        = "width"
+	MetadataHeight       = "height"
+	MetadataOrientation  = "orientation"
+	MetadataCameraMake   = "exif-make"
+	MetadataCameraModel  = "exif-model"
+	MetadataDateTime     = "exif-datetime"
+	MetadataGPSLatitude  = "gps-latitude"
+	MetadataGPSLongitude = "gps-longitude"
+)
+
+// Analyzer extracts metadata from files, like analyzers of ActiveStorage.
+type Analyzer interface {
+	// Accept reports whether the analyzer supports files of contentType.
+	Accept(contentType string) bool
+	// Analyze returns metadata of content. Implementations must not keep reading content after returning.
+	Analyze(ctx context.Context, content io.Reader) (map[string]string, error)
+}
+
+// Analyze analyzes content by the first analyzer accepting contentType. It returns nil if no analyzer accepts.
+func Analyze(ctx context.Context, content io.Reader, contentType string, analyzers ...Analyzer) (map[string]string, error) {
+	for _, analyzer := range analyzers {
+		if analyzer.Accept(contentType) {
+			return analyzer.Analyze(ctx, content)
+		}
+	}
+	return nil, nil
+}
+
+type imageAnalyzer struct{}
+
+// NewImageAnalyzer returns an Analyzer of images, extracting width and height after EXIF orientation,
+// orientation, and EXIF camera, date time and GPS position if present.
+func NewImageAnalyzer() Analyzer {
+	return imageAnalyzer{}
+}
+
+func (imageAnalyzer) Accept(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/")
+}
+
+func (imageAnalyzer) Analyze(ctx context.Context, content io.Reader) (map[string]string, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := decodeImg(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	metadata := map[string]string{
+		MetadataWidth:  strconv.Itoa(img.Bounds().Dx()),
+		MetadataHeight: strconv.Itoa(img.Bounds().Dy()),
+	}
+
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		// most formats other than jpeg and many jpeg have no EXIF
+		return metadata, nil
+	}
+
+	if tag, err := x.Get(exif.Orientation); err == nil {
+		if v, err := tag.Int(0); err == nil {
+			metadata[MetadataOrientation] = strconv.Itoa(v)
+		}
+	}
+	for name, key := range map[exif.FieldName]string{
+		exif.Make:  MetadataCameraMake,
+		exif.Model: MetadataCameraModel,
+	} {
+		if tag, err := x.Get(name); err == nil {
+			if v, err := tag.StringVal(); err == nil {
+				metadata[key] = strings.TrimSpace(strings.TrimRight(v, "\x00"))
+			}
+		}
+	}
+	if t, err := x.DateTime(); err == nil {
+		metadata[MetadataDateTime] = t.Format("2006-01-02T15:04:05")
+	}
+	if lat, long, err := x.LatLong(); err == nil {
+		metadata[MetadataGPSLatitude] = fmt.Sprintf("%.6f", lat)
+		metadata[MetadataGPSLongitude] = fmt.Sprintf("%.6f", long)
+	}
+
+	return metadata, nil
+}
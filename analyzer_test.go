@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// jpegWithExif returns a jpeg of w x h with EXIF make "Test" and orientation 6, rotated 90° clockwise.
+func jpegWithExif(t *testing.T, w, h int) []byte {
+	var img bytes.Buffer
+	require.NoError(t, jpeg.Encode(&img, image.NewRGBA(image.Rect(0, 0, w, h)), nil))
+
+	var tiff bytes.Buffer
+	le := binary.LittleEndian
+	tiff.WriteString("II")
+	_ = binary.Write(&tiff, le, uint16(42))
+	_ = binary.Write(&tiff, le, uint32(8))
+	_ = binary.Write(&tiff, le, uint16(2))
+	// make, ascii stored after the IFD at 8 + 2 + 2*12 + 4
+	_ = binary.Write(&tiff, le, []uint16{0x010f, 2})
+	_ = binary.Write(&tiff, le, []uint32{5, 38})
+	// orientation, short
+	_ = binary.Write(&tiff, le, []uint16{0x0112, 3})
+	_ = binary.Write(&tiff, le, []uint32{1, 6})
+	_ = binary.Write(&tiff, le, uint32(0))
+	tiff.WriteString("Test\x00")
+
+	var out bytes.Buffer
+	out.Write([]byte{0xff, 0xd8, 0xff, 0xe1})
+	_ = binary.Write(&out, binary.BigEndian, uint16(2+6+tiff.Len()))
+	out.WriteString("Exif\x00\x00")
+	out.Write(tiff.Bytes())
+	out.Write(img.Bytes()[2:])
+	return out.Bytes()
+}
+
+func TestImageAnalyzer(t *testing.T) {
+	t.Parallel()
+
+	analyzer := NewImageAnalyzer()
+	require.True(t, analyzer.Accept("image/png"))
+	require.False(t, analyzer.Accept("application/pdf"))
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 30, 20))))
+	metadata, err := Analyze(context.TODO(), &buf, "image/png", analyzer)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{MetadataWidth: "30", MetadataHeight: "20"}, metadata)
+
+	metadata, err = analyzer.Analyze(context.TODO(), bytes.NewReader(jpegWithExif(t, 30, 20)))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		MetadataWidth:       "20",
+		MetadataHeight:      "30",
+		MetadataOrientation: "6",
+		MetadataCameraMake:  "Test",
+	}, metadata)
+}
+
+func TestStorageCreateAnalyzes(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	store := New(service, nil, StorageOptions{Analyzers: []Analyzer{NewImageAnalyzer()}})
+
+	blob, err := store.Create(context.TODO(), bytes.NewReader(jpegWithExif(t, 30, 20)), "photo.jpg")
+	require.NoError(t, err)
+	require.Equal(t, "20", blob.Metadata[MetadataWidth])
+	require.Equal(t, "Test", blob.Metadata[MetadataCameraMake])
+
+	// failed analysis doesn't fail Create
+	blob, err = store.Create(context.TODO(), bytes.NewReader([]byte("not an image")), "broken.jpg")
+	require.NoError(t, err)
+	require.Empty(t, blob.Metadata)
+
+	// metadata of the context is not modified
+	metadata := map[string]string{"owner": "1"}
+	blob, err = store.Create(WithMetadata(context.TODO(), metadata), bytes.NewReader(jpegWithExif(t, 30, 20)), "photo.jpg")
+	require.NoError(t, err)
+	require.Equal(t, "20", blob.Metadata[MetadataWidth])
+	require.Equal(t, map[string]string{"owner": "1"}, metadata)
+}
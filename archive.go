@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// RestoreOptions configures restores of archived objects.
+type RestoreOptions struct {
+	// Days the restored copy is available. Default is 1.
+	Days int
+	// Tier is the retrieval tier, such as "Expedited", "Standard" or "Bulk" of S3. Default is the backend default.
+	Tier string
+}
+
+// ArchiveStatus is the archival state of an object.
+type ArchiveStatus struct {
+	StorageClass string
+	// Archived reports whether the object must be restored before download.
+	Archived bool
+	// Ongoing reports whether a restore is in progress.
+	Ongoing bool
+	// ExpiresAt is the expiration of the restored copy, zero if not restored.
+	ExpiresAt time.Time
+}
+
+// Restored reports whether the restored copy of an archived object is available.
+func (s ArchiveStatus) Restored() bool {
+	return !s.Ongoing && !s.ExpiresAt.IsZero()
+}
+
+// Archiver is implemented by services with storage classes and archival, such as S3 Glacier.
+type Archiver interface {
+	// Transition moves key to storageClass, such as "STANDARD_IA" or "GLACIER".
+	Transition(ctx context.Context, key string, storageClass string) error
+	// Restore initiates a restore of archived key. Restoring an object being restored is not an error.
+	Restore(ctx context.Context, key string, options RestoreOptions) error
+	// RestoreStatus returns the archival state of key, poll it until Restored.
+	RestoreStatus(ctx context.Context, key string) (ArchiveStatus, error)
+}
+
+// Transition moves key to storageClass. It returns ErrNotSupported if service doesn't implement Archiver.
+func Transition(ctx context.Context, service Service, key string, storageClass string) error {
+	if a, ok := service.(Archiver); ok {
+		return a.Transition(ctx, key, storageClass)
+	}
+	return ErrNotSupported
+}
+
+// Restore initiates a restore of archived key. It returns ErrNotSupported if service doesn't implement Archiver.
+func Restore(ctx context.Context, service Service, key string, options RestoreOptions) error {
+	if a, ok := service.(Archiver); ok {
+		return a.Restore(ctx, key, options)
+	}
+	return ErrNotSupported
+}
+
+// RestoreStatus returns the archival state of key. It returns ErrNotSupported if service doesn't implement Archiver.
+func RestoreStatus(ctx context.Context, service Service, key string) (ArchiveStatus, error) {
+	if a, ok := service.(Archiver); ok {
+		return a.RestoreStatus(ctx, key)
+	}
+	return ArchiveStatus{}, ErrNotSupported
+}
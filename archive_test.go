@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchive_notSupported(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	ctx := context.TODO()
+	require.NoError(t, service.Upload(ctx, "doc.txt", strings.NewReader("v1")))
+
+	require.ErrorIs(t, Transition(ctx, service, "doc.txt", "GLACIER"), ErrNotSupported)
+	require.ErrorIs(t, Restore(ctx, service, "doc.txt", RestoreOptions{}), ErrNotSupported)
+	_, err = RestoreStatus(ctx, service, "doc.txt")
+	require.ErrorIs(t, err, ErrNotSupported)
+}
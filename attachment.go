@@ -0,0 +1,317 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Attachment links a blob to an application record under a name, like Attachment of ActiveStorage,
+// such as the "avatar" of ("User", "42").
+type Attachment struct {
+	RecordType string
+	RecordID   string
+	Name       string
+	BlobKey    string
+	CreatedAt  time.Time
+}
+
+// AttachmentStore persists attachments.
+type AttachmentStore interface {
+	Create(ctx context.Context, attachment Attachment) error
+	// List returns attachments of a record under name ordered by creation.
+	List(ctx context.Context, recordType, recordID, name string) ([]Attachment, error)
+	// Delete deletes attachments of blobKey to a record. Missing attachments return errors matching fs.ErrNotExist.
+	Delete(ctx context.Context, recordType, recordID, name, blobKey string) error
+	// Referenced reports whether any record is attached to blobKey.
+	Referenced(ctx context.Context, blobKey string) (bool, error)
+}
+
+type memoryAttachmentStore struct {
+	mu          sync.RWMutex
+	attachments []Attachment
+}
+
+// NewMemoryAttachmentStore returns an AttachmentStore keeping attachments in memory.
+func NewMemoryAttachmentStore() AttachmentStore {
+	return &memoryAttachmentStore{}
+}
+
+func (s *memoryAttachmentStore) Create(ctx context.Context, attachment Attachment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attachments = append(s.attachments, attachment)
+	return nil
+}
+
+func (s *memoryAttachmentStore) List(ctx context.Context, recordType, recordID, name string) ([]Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var attachments []Attachment
+	for _, a := range s.attachments {
+		if a.RecordType == recordType && a.RecordID == recordID && a.Name == name {
+			attachments = append(attachments, a)
+		}
+	}
+	sort.SliceStable(attachments, func(i, j int) bool {
+		return attachments[i].CreatedAt.Before(attachments[j].CreatedAt)
+	})
+	return attachments, nil
+}
+
+func (s *memoryAttachmentStore) Delete(ctx context.Context, recordType, recordID, name, blobKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.attachments[:0]
+	for _, a := range s.attachments {
+		if a.RecordType != recordType || a.RecordID != recordID || a.Name != name || a.BlobKey != blobKey {
+			kept = append(kept, a)
+		}
+	}
+	if len(kept) == len(s.attachments) {
+		return notExistError("delete", blobKey)
+	}
+	clear(s.attachments[len(kept):])
+	s.attachments = kept
+	return nil
+}
+
+func (s *memoryAttachmentStore) Referenced(ctx context.Context, blobKey string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, a := range s.attachments {
+		if a.BlobKey == blobKey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type sqlAttachmentStore struct {
+	db      *sql.DB
+	options SQLOptions
+}
+
+// NewSQLAttachmentStore returns an AttachmentStore backed by database/sql. Default table is "storage_attachments" with columns
+//
+//	record_type VARCHAR(255), record_id VARCHAR(255), name VARCHAR(255), blob_key VARCHAR(1024), created_at TIMESTAMP
+//
+// An index on (record_type, record_id, name) and one on blob_key are recommended.
+func NewSQLAttachmentStore(db *sql.DB, options ...SQLOptions) AttachmentStore {
+	s := &sqlAttachmentStore{
+		db:      db,
+		options: SQLOptions{Table: "storage_attachments"},
+	}
+	for _, opt := range options {
+		if opt.Table != "" {
+			s.options.Table = opt.Table
+		}
+		if opt.Placeholder != nil {
+			s.options.Placeholder = opt.Placeholder
+		}
+	}
+	return s
+}
+
+func (s *sqlAttachmentStore) Create(ctx context.Context, attachment Attachment) error {
+	query := fmt.Sprintf("INSERT INTO %s (record_type, record_id, name, blob_key, created_at) VALUES (%s)",
+		s.options.Table, s.options.placeholders(1, 5))
+	_, err := s.db.ExecContext(ctx, query,
+		attachment.RecordType, attachment.RecordID, attachment.Name, attachment.BlobKey, attachment.CreatedAt)
+	return err
+}
+
+func (s *sqlAttachmentStore) List(ctx context.Context, recordType, recordID, name string) ([]Attachment, error) {
+	query := fmt.Sprintf("SELECT record_type, record_id, name, blob_key, created_at FROM %s WHERE record_type = %s AND record_id = %s AND name = %s ORDER BY created_at",
+		s.options.Table, s.options.placeholders(1, 1), s.options.placeholders(2, 1), s.options.placeholders(3, 1))
+	rows, err := s.db.QueryContext(ctx, query, recordType, recordID, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []Attachment
+	for rows.Next() {
+		var a Attachment
+		err = rows.Scan(&a.RecordType, &a.RecordID, &a.Name, &a.BlobKey, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+func (s *sqlAttachmentStore) Delete(ctx context.Context, recordType, recordID, name, blobKey string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE record_type = %s AND record_id = %s AND name = %s AND blob_key = %s",
+		s.options.Table, s.options.placeholders(1, 1), s.options.placeholders(2, 1), s.options.placeholders(3, 1), s.options.placeholders(4, 1))
+	result, err := s.db.ExecContext(ctx, query, recordType, recordID, name, blobKey)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notExistError("delete", blobKey)
+	}
+	return nil
+}
+
+func (s *sqlAttachmentStore) Referenced(ctx context.Context, blobKey string) (bool, error) {
+	query := fmt.Sprintf("SELECT 1 FROM %s WHERE blob_key = %s LIMIT 1", s.options.Table, s.options.placeholders(1, 1))
+	var one int
+	err := s.db.QueryRowContext(ctx, query, blobKey).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Attachments attaches blobs of a Storage to application records.
+type Attachments interface {
+	// Attach attaches the blob of blobKey to a record under name, records may have many blobs under a name.
+	Attach(ctx context.Context, recordType, recordID, name, blobKey string) error
+	// Replace attaches the blob of blobKey as the only blob of a record under name,
+	// previously attached blobs are detached and purged unless attached elsewhere.
+	Replace(ctx context.Context, recordType, recordID, name, blobKey string) error
+	// Blobs returns blobs attached to a record under name.
+	Blobs(ctx context.Context, recordType, recordID, name string) ([]Blob, error)
+	// Detach removes the attachment, keeping the blob and the object.
+	Detach(ctx context.Context, recordType, recordID, name, blobKey string) error
+	// Purge detaches the blob and deletes it with its object and variants unless attached elsewhere.
+	Purge(ctx context.Context, recordType, recordID, name, blobKey string) error
+}
+
+type attachments struct {
+	storage Storage
+	store   AttachmentStore
+}
+
+// NewAttachments returns Attachments of blobs created by storage, persisted in store.
+// Purging variants needs the service of storage to implement Lister.
+func NewAttachments(storage Storage, store AttachmentStore) Attachments {
+	return &attachments{
+		storage: storage,
+		store:   store,
+	}
+}
+
+func (a *attachments) Attach(ctx context.Context, recordType, recordID, name, blobKey string) error {
+	_, err := a.storage.Blobs().Find(ctx, blobKey)
+	if err != nil {
+		return err
+	}
+
+	return a.store.Create(ctx, Attachment{
+		RecordType: recordType,
+		RecordID:   recordID,
+		Name:       name,
+		BlobKey:    blobKey,
+		CreatedAt:  time.Now().UTC(),
+	})
+}
+
+func (a *attachments) Replace(ctx context.Context, recordType, recordID, name, blobKey string) error {
+	existing, err := a.store.List(ctx, recordType, recordID, name)
+	if err != nil {
+		return err
+	}
+
+	attached := false
+	for _, old := range existing {
+		attached = attached || old.BlobKey == blobKey
+	}
+	if !attached {
+		err = a.Attach(ctx, recordType, recordID, name, blobKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	purged := make(map[string]bool)
+	for _, old := range existing {
+		// Purge detaches all attachments of a blob at once
+		if old.BlobKey == blobKey || purged[old.BlobKey] {
+			continue
+		}
+		err = a.Purge(ctx, recordType, recordID, name, old.BlobKey)
+		if err != nil {
+			return err
+		}
+		purged[old.BlobKey] = true
+	}
+	return nil
+}
+
+func (a *attachments) Blobs(ctx context.Context, recordType, recordID, name string) ([]Blob, error) {
+	list, err := a.store.List(ctx, recordType, recordID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make([]Blob, 0, len(list))
+	for _, attachment := range list {
+		blob, err := a.storage.Blobs().Find(ctx, attachment.BlobKey)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, blob)
+	}
+	return blobs, nil
+}
+
+func (a *attachments) Detach(ctx context.Context, recordType, recordID, name, blobKey string) error {
+	return a.store.Delete(ctx, recordType, recordID, name, blobKey)
+}
+
+// Purge reattaches the blob if its variants or object can't be deleted, so it can be purged again.
+func (a *attachments) Purge(ctx context.Context, recordType, recordID, name, blobKey string) error {
+	existing, err := a.store.List(ctx, recordType, recordID, name)
+	if err != nil {
+		return err
+	}
+	err = a.store.Delete(ctx, recordType, recordID, name, blobKey)
+	if err != nil {
+		return err
+	}
+
+	referenced, err := a.store.Referenced(ctx, blobKey)
+	if err != nil || referenced {
+		return err
+	}
+
+	service := a.storage.Service()
+	err = DeleteVariants(ctx, service, blobKey)
+	if err == nil {
+		err = service.Delete(ctx, blobKey)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return a.reattach(ctx, existing, blobKey, err)
+	}
+	err = a.storage.Blobs().Delete(ctx, blobKey)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// reattach restores the attachments of blobKey in existing detached by a failed Purge, and returns err.
+func (a *attachments) reattach(ctx context.Context, existing []Attachment, blobKey string, err error) error {
+	ctx = context.WithoutCancel(ctx)
+	for _, attachment := range existing {
+		if attachment.BlobKey != blobKey {
+			continue
+		}
+		if createErr := a.store.Create(ctx, attachment); createErr != nil {
+			return errors.Join(err, createErr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttachments(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	store := New(service, nil)
+	attachments := NewAttachments(store, NewMemoryAttachmentStore())
+	ctx := context.TODO()
+
+	first, err := store.Create(ctx, strings.NewReader("first"), "first.jpg")
+	require.NoError(t, err)
+	second, err := store.Create(ctx, strings.NewReader("second"), "second.jpg")
+	require.NoError(t, err)
+	variant := store.Variant(first.Key, VariantOptions{}.SetSize(100))
+	require.NoError(t, service.Upload(ctx, variant.Key(), strings.NewReader("variant")))
+
+	require.NoError(t, attachments.Attach(ctx, "User", "1", "avatar", first.Key))
+	require.NoError(t, attachments.Attach(ctx, "Post", "1", "images", first.Key))
+	require.ErrorIs(t, attachments.Attach(ctx, "User", "1", "avatar", "missing.jpg"), fs.ErrNotExist)
+
+	// the replaced blob is kept while attached elsewhere
+	require.NoError(t, attachments.Replace(ctx, "User", "1", "avatar", second.Key))
+	blobs, err := attachments.Blobs(ctx, "User", "1", "avatar")
+	require.NoError(t, err)
+	require.Equal(t, []Blob{second}, blobs)
+	_, err = store.Blobs().Find(ctx, first.Key)
+	require.NoError(t, err)
+
+	// purging the last attachment deletes the blob, object and variants
+	require.NoError(t, attachments.Purge(ctx, "Post", "1", "images", first.Key))
+	_, err = store.Blobs().Find(ctx, first.Key)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	for _, key := range []string{first.Key, variant.Key()} {
+		exist, err := service.Exist(ctx, key)
+		require.NoError(t, err)
+		require.False(t, exist, key)
+	}
+
+	// replacing with the attached blob keeps it
+	require.NoError(t, attachments.Replace(ctx, "User", "1", "avatar", second.Key))
+	blobs, err = attachments.Blobs(ctx, "User", "1", "avatar")
+	require.NoError(t, err)
+	require.Equal(t, []Blob{second}, blobs)
+
+	require.NoError(t, attachments.Detach(ctx, "User", "1", "avatar", second.Key))
+	exist, err := service.Exist(ctx, second.Key)
+	require.NoError(t, err)
+	require.True(t, exist)
+}
+
+// unlistedService hides List of a service, so variants can't be deleted.
+type unlistedService struct {
+	Service
+}
+
+func TestAttachments_purgeFailed(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	store := New(unlistedService{service}, nil)
+	attachments := NewAttachments(store, NewMemoryAttachmentStore())
+	ctx := context.TODO()
+
+	blob, err := store.Create(ctx, strings.NewReader("first"), "first.jpg")
+	require.NoError(t, err)
+	require.NoError(t, attachments.Attach(ctx, "User", "1", "avatar", blob.Key))
+
+	require.ErrorIs(t, attachments.Purge(ctx, "User", "1", "avatar", blob.Key), ErrNotSupported)
+	blobs, err := attachments.Blobs(ctx, "User", "1", "avatar")
+	require.NoError(t, err)
+	require.Equal(t, []Blob{blob}, blobs)
+	exist, err := service.Exist(ctx, blob.Key)
+	require.NoError(t, err)
+	require.True(t, exist)
+}
+
+func TestSQLAttachmentStore(t *testing.T) {
+	t.Parallel()
+
+	db := newSQLiteDB(t, `CREATE TABLE attachments (
+		record_type VARCHAR(255), record_id VARCHAR(255), name VARCHAR(255), blob_key VARCHAR(1024), created_at TIMESTAMP)`)
+	store := NewSQLAttachmentStore(db, SQLOptions{Table: "attachments"})
+	ctx := context.TODO()
+
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	// created out of order
+	for _, a := range []Attachment{
+		{RecordType: "User", RecordID: "1", Name: "photos", BlobKey: "b", CreatedAt: now.Add(time.Second)},
+		{RecordType: "User", RecordID: "1", Name: "photos", BlobKey: "a", CreatedAt: now},
+		{RecordType: "User", RecordID: "1", Name: "avatar", BlobKey: "c", CreatedAt: now},
+		{RecordType: "User", RecordID: "2", Name: "photos", BlobKey: "a", CreatedAt: now},
+	} {
+		require.NoError(t, store.Create(ctx, a))
+	}
+
+	list := func(recordID string) []string {
+		attachments, err := store.List(ctx, "User", recordID, "photos")
+		require.NoError(t, err)
+		var keys []string
+		for _, a := range attachments {
+			keys = append(keys, a.BlobKey)
+		}
+		return keys
+	}
+	listed, err := store.List(ctx, "User", "1", "photos")
+	require.NoError(t, err)
+	require.Equal(t, Attachment{RecordType: "User", RecordID: "1", Name: "photos", BlobKey: "a", CreatedAt: now}, listed[0])
+	require.Equal(t, []string{"a", "b"}, list("1"))
+	require.Equal(t, []string{"a"}, list("2"))
+	require.Empty(t, list("3"))
+
+	require.NoError(t, store.Delete(ctx, "User", "1", "photos", "a"))
+	require.ErrorIs(t, store.Delete(ctx, "User", "1", "photos", "a"), fs.ErrNotExist)
+	require.Equal(t, []string{"b"}, list("1"))
+
+	for key, want := range map[string]bool{"a": true, "b": true, "c": true, "d": false} {
+		referenced, err := store.Referenced(ctx, key)
+		require.NoError(t, err)
+		require.Equal(t, want, referenced, key)
+	}
+	require.NoError(t, store.Delete(ctx, "User", "2", "photos", "a"))
+	referenced, err := store.Referenced(ctx, "a")
+	require.NoError(t, err)
+	require.False(t, referenced)
+
+	// attached blobs are listed from the SQL stores in order
+	service, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	storage := New(service, nil, StorageOptions{Blobs: NewSQLBlobStore(newSQLiteDB(t, sqliteBlobsSchema))})
+	attachments := NewAttachments(storage, store)
+	var created []Blob
+	for _, content := range []string{"first", "second"} {
+		blob, err := storage.Create(ctx, strings.NewReader(content), content+".txt")
+		require.NoError(t, err)
+		require.NoError(t, attachments.Attach(ctx, "Post", "1", "files", blob.Key))
+		created = append(created, blob)
+	}
+	require.ErrorIs(t, attachments.Attach(ctx, "Post", "1", "files", "missing.txt"), fs.ErrNotExist)
+	blobs, err := attachments.Blobs(ctx, "Post", "1", "files")
+	require.NoError(t, err)
+	require.Len(t, blobs, 2)
+	for i, blob := range blobs {
+		require.Equal(t, created[i].Key, blob.Key)
+		require.Equal(t, created[i].Filename, blob.Filename)
+	}
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Blob is a record of a stored file, like Blob of ActiveStorage.
+type Blob struct {
+	Key         string
+	Filename    string
+	ContentType string
+	ByteSize    int64
+	// Checksum is the base64 MD5 of the content, like ActiveStorage and the Content-MD5 header.
+	Checksum  string
+	Metadata  map[string]string
+	CreatedAt time.Time
+}
+
+// ErrBlobExists is matched by errors of creating a blob with an existing key. It matches fs.ErrExist.
+var ErrBlobExists = fmt.Errorf("%w: blob", fs.ErrExist)
+
+// BlobStore persists blobs. Find and Delete of missing blobs return errors matching fs.ErrNotExist,
+// Create of existing keys returns errors matching ErrBlobExists.
+type BlobStore interface {
+	Create(ctx context.Context, blob Blob) error
+	Find(ctx context.Context, key string) (Blob, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type memoryBlobStore struct {
+	mu    sync.RWMutex
+	blobs map[string]Blob
+}
+
+// NewMemoryBlobStore returns a BlobStore keeping blobs in memory.
+func NewMemoryBlobStore() BlobStore {
+	return &memoryBlobStore{
+		blobs: make(map[string]Blob),
+	}
+}
+
+func (s *memoryBlobStore) Create(ctx context.Context, blob Blob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.blobs[blob.Key]; ok {
+		return fmt.Errorf("%w: %q", ErrBlobExists, blob.Key)
+	}
+	blob.Metadata = copyMetadata(blob.Metadata)
+	s.blobs[blob.Key] = blob
+	return nil
+}
+
+func (s *memoryBlobStore) Find(ctx context.Context, key string) (Blob, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	blob, ok := s.blobs[key]
+	if !ok {
+		return Blob{}, notExistError("find", key)
+	}
+	blob.Metadata = copyMetadata(blob.Metadata)
+	return blob, nil
+}
+
+func (s *memoryBlobStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.blobs[key]; !ok {
+		return notExistError("delete", key)
+	}
+	delete(s.blobs, key)
+	return nil
+}
+
+// SQLOptions configures stores backed by database/sql.
+type SQLOptions struct {
+	// Table name.
+	Table string
+	// Placeholder returns the placeholder of the n-th argument starting at 1.
+	// Default is "?" for MySQL and SQLite, use DollarPlaceholder for PostgreSQL.
+	Placeholder func(n int) string
+}
+
+// DollarPlaceholder returns PostgreSQL placeholders such as "$1".
+func DollarPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (o SQLOptions) placeholders(from, count int) string {
+	p := make([]string, count)
+	for i := range p {
+		if o.Placeholder == nil {
+			p[i] = "?"
+		} else {
+			p[i] = o.Placeholder(from + i)
+		}
+	}
+	return strings.Join(p, ", ")
+}
+
+type sqlBlobStore struct {
+	db      *sql.DB
+	options SQLOptions
+}
+
+// NewSQLBlobStore returns a BlobStore backed by database/sql. Default table is "storage_blobs" with columns
+//
+//	blob_key VARCHAR(1024) PRIMARY KEY, filename VARCHAR(1024), content_type VARCHAR(255), byte_size BIGINT,
+//	checksum VARCHAR(255), metadata TEXT, created_at TIMESTAMP
+//
+// Metadata is stored as JSON.
+func NewSQLBlobStore(db *sql.DB, options ...SQLOptions) BlobStore {
+	s := &sqlBlobStore{
+		db:      db,
+		options: SQLOptions{Table: "storage_blobs"},
+	}
+	for _, opt := range options {
+		if opt.Table != "" {
+			s.options.Table = opt.Table
+		}
+		if opt.Placeholder != nil {
+			s.options.Placeholder = opt.Placeholder
+		}
+	}
+	return s
+}
+
+func (s *sqlBlobStore) Create(ctx context.Context, blob Blob) error {
+	metadata, err := json.Marshal(blob.Metadata)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (blob_key, filename, content_type, byte_size, checksum, metadata, created_at) VALUES (%s)",
+		s.options.Table, s.options.placeholders(1, 7))
+	_, err = s.db.ExecContext(ctx, query,
+		blob.Key, blob.Filename, blob.ContentType, blob.ByteSize, blob.Checksum, string(metadata), blob.CreatedAt)
+	if err != nil {
+		// errors of unique constraints differ by driver
+		if _, findErr := s.Find(ctx, blob.Key); findErr == nil {
+			return fmt.Errorf("%w: %q: %v", ErrBlobExists, blob.Key, err)
+		}
+	}
+	return err
+}
+
+func (s *sqlBlobStore) Find(ctx context.Context, key string) (Blob, error) {
+	query := fmt.Sprintf("SELECT blob_key, filename, content_type, byte_size, checksum, metadata, created_at FROM %s WHERE blob_key = %s",
+		s.options.Table, s.options.placeholders(1, 1))
+
+	var blob Blob
+	var metadata string
+	err := s.db.QueryRowContext(ctx, query, key).Scan(
+		&blob.Key, &blob.Filename, &blob.ContentType, &blob.ByteSize, &blob.Checksum, &metadata, &blob.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Blob{}, notExistError("find", key)
+	}
+	if err != nil {
+		return Blob{}, err
+	}
+
+	err = json.Unmarshal([]byte(metadata), &blob.Metadata)
+	if err != nil {
+		return Blob{}, err
+	}
+	return blob, nil
+}
+
+func (s *sqlBlobStore) Delete(ctx context.Context, key string) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE blob_key = %s", s.options.Table, s.options.placeholders(1, 1))
+	result, err := s.db.ExecContext(ctx, query, key)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notExistError("delete", key)
+	}
+	return nil
+}
+
+func copyMetadata(metadata map[string]string) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+	m := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		m[k] = v
+	}
+	return m
+}
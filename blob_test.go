@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+type failingBlobStore struct {
+	BlobStore
+}
+
+func (s failingBlobStore) Create(ctx context.Context, blob Blob) error {
+	return errors.New("db is down")
+}
+
+// flakyBlobStore fails Create, and Find after the first call.
+type flakyBlobStore struct {
+	BlobStore
+	finds int
+}
+
+func (s *flakyBlobStore) Create(ctx context.Context, blob Blob) error {
+	return errors.New("db is down")
+}
+
+func (s *flakyBlobStore) Find(ctx context.Context, key string) (Blob, error) {
+	s.finds++
+	if s.finds > 1 {
+		return Blob{}, errors.New("db is down")
+	}
+	return s.BlobStore.Find(ctx, key)
+}
+
+func TestStorageCreate(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	ctx := context.TODO()
+
+	store := New(service, nil)
+	blob, err := store.Create(WithMetadata(ctx, map[string]string{"owner": "1"}), strings.NewReader("hello"), "dir/hello.txt")
+	require.NoError(t, err)
+	require.Equal(t, "hello.txt", blob.Filename)
+	require.Equal(t, "text/plain; charset=utf-8", blob.ContentType)
+	require.Equal(t, int64(5), blob.ByteSize)
+	require.Equal(t, "XUFAKrxLKna5cZ2REBfFkg==", blob.Checksum)
+	require.Equal(t, map[string]string{"owner": "1"}, blob.Metadata)
+	require.True(t, strings.HasSuffix(blob.Key, ".txt"))
+
+	found, err := store.Blobs().Find(ctx, blob.Key)
+	require.NoError(t, err)
+	require.Equal(t, blob, found)
+	exist, err := service.Exist(ctx, blob.Key)
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	_, err = store.Blobs().Find(ctx, "missing")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	// the object is deleted if the blob can't be recorded
+	store = New(service, nil, StorageOptions{Blobs: failingBlobStore{NewMemoryBlobStore()}, Keys: ContentHashKeys()})
+	_, err = store.Create(ctx, strings.NewReader("bye"), "bye.txt")
+	require.Error(t, err)
+	var keys []string
+	err = List(ctx, service, "", func(obj ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{blob.Key}, keys)
+}
+
+func TestStorageCreate_sniff(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	ctx := context.TODO()
+	store := New(service, nil)
+
+	// content wins over the extension unless it's generic
+	blob, err := store.Create(ctx, strings.NewReader("\x89PNG\r\n\x1a\n0000"), "photo.jpg")
+	require.NoError(t, err)
+	require.Equal(t, "image/png", blob.ContentType)
+	info, err := Stat(ctx, service, blob.Key)
+	require.NoError(t, err)
+	require.Equal(t, "image/png", info.ContentType)
+
+	blob, err = store.Create(ctx, strings.NewReader(`{"a":1}`), "data.json")
+	require.NoError(t, err)
+	require.Equal(t, "application/json", blob.ContentType)
+
+	blob, err = store.Create(WithContentType(ctx, "text/csv"), strings.NewReader("a,b"), "data")
+	require.NoError(t, err)
+	require.Equal(t, "text/csv", blob.ContentType)
+}
+
+func TestStorageCreate_sameContent(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	ctx := context.TODO()
+
+	store := New(service, nil, StorageOptions{Keys: ContentHashKeys()})
+	blob, err := store.Create(WithMetadata(ctx, map[string]string{"owner": "1"}), strings.NewReader("hello"), "a.txt")
+	require.NoError(t, err)
+
+	// the same content gets the same key, which is recorded already and not overwritten
+	_, err = store.Create(WithMetadata(ctx, map[string]string{"owner": "2"}), strings.NewReader("hello"), "b.txt")
+	require.ErrorIs(t, err, ErrBlobExists)
+
+	info, err := Stat(ctx, service, blob.Key)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"owner": "1"}, info.Metadata)
+	found, err := store.Blobs().Find(ctx, blob.Key)
+	require.NoError(t, err)
+	require.Equal(t, "a.txt", found.Filename)
+
+	// the object is kept if it's unknown whether a blob exists
+	store = New(service, nil, StorageOptions{Keys: ContentHashKeys(), Blobs: &flakyBlobStore{BlobStore: NewMemoryBlobStore()}})
+	_, err = store.Create(ctx, strings.NewReader("flaky"), "c.txt")
+	require.Error(t, err)
+	key, err := ContentHashKeys().GenerateKey(ctx, "c.txt", strings.NewReader("flaky"))
+	require.NoError(t, err)
+	exist, err := service.Exist(ctx, key)
+	require.NoError(t, err)
+	require.True(t, exist)
+}
+
+const sqliteBlobsSchema = `CREATE TABLE storage_blobs (
+	blob_key VARCHAR(1024) PRIMARY KEY, filename VARCHAR(1024), content_type VARCHAR(255), byte_size BIGINT,
+	checksum VARCHAR(255), metadata TEXT, created_at TIMESTAMP)`
+
+func newSQLiteDB(t *testing.T, schema string) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	// every connection opens a new in-memory database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	_, err = db.Exec(schema)
+	require.NoError(t, err)
+	return db
+}
+
+func TestSQLBlobStore(t *testing.T) {
+	t.Parallel()
+
+	store := NewSQLBlobStore(newSQLiteDB(t, sqliteBlobsSchema))
+	ctx := context.TODO()
+
+	blob := Blob{
+		Key:         "a1b2",
+		Filename:    "a.txt",
+		ContentType: "text/plain",
+		ByteSize:    5,
+		Checksum:    "XUFAKrxLKna5cZ2REBfFkg==",
+		Metadata:    map[string]string{"owner": "1"},
+		CreatedAt:   time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	require.NoError(t, store.Create(ctx, blob))
+	found, err := store.Find(ctx, blob.Key)
+	require.NoError(t, err)
+	require.Equal(t, blob, found)
+
+	err = store.Create(ctx, Blob{Key: blob.Key, Filename: "b.txt"})
+	require.ErrorIs(t, err, ErrBlobExists)
+	found, err = store.Find(ctx, blob.Key)
+	require.NoError(t, err)
+	require.Equal(t, "a.txt", found.Filename)
+
+	require.NoError(t, store.Create(ctx, Blob{Key: "c3d4", CreatedAt: blob.CreatedAt}))
+	found, err = store.Find(ctx, "c3d4")
+	require.NoError(t, err)
+	require.Nil(t, found.Metadata)
+
+	require.NoError(t, store.Delete(ctx, blob.Key))
+	_, err = store.Find(ctx, blob.Key)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	require.ErrorIs(t, store.Delete(ctx, blob.Key), fs.ErrNotExist)
+}
@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidContentKey is returned for keys not created by a ContentStore.
+var ErrInvalidContentKey = fmt.Errorf("%w: not a content key", ErrInvalidKey)
+
+// ErrRefNotFound is returned by RefCounter.Decrement for keys without count. It matches fs.ErrNotExist.
+var ErrRefNotFound = fmt.Errorf("%w: no reference count", fs.ErrNotExist)
+
+// RefCounter persists reference counts of content keys for the store created by NewContentStore.
+// Implementations must be safe for concurrent use.
+type RefCounter interface {
+	// Increment increments the count of key and returns the new count.
+	Increment(ctx context.Context, key string) (int64, error)
+	// Decrement decrements the count of key and returns the new count. Keys are forgotten at zero.
+	// It returns ErrRefNotFound for keys without count, such as counts lost by a restart.
+	Decrement(ctx context.Context, key string) (int64, error)
+}
+
+type memoryRefCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// NewMemoryRefCounter returns a RefCounter keeping counts in memory.
+func NewMemoryRefCounter() RefCounter {
+	return &memoryRefCounter{
+		counts: make(map[string]int64),
+	}
+}
+
+func (c *memoryRefCounter) Increment(ctx context.Context, key string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[key]++
+	return c.counts[key], nil
+}
+
+func (c *memoryRefCounter) Decrement(ctx context.Context, key string) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count, ok := c.counts[key]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrRefNotFound, key)
+	}
+	n := count - 1
+	if n <= 0 {
+		delete(c.counts, key)
+		return 0, nil
+	}
+	c.counts[key] = n
+	return n, nil
+}
+
+// ContentStore stores files by the SHA-256 of their content, so identical files are stored once.
+type ContentStore interface {
+	// Put stores content of reader unless stored already, adds a reference and returns the content key.
+	Put(ctx context.Context, reader io.Reader) (string, error)
+	// Get downloads content of key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Retain adds a reference to stored content, such as when a record is duplicated.
+	Retain(ctx context.Context, key string) error
+	// Release removes a reference and deletes the content when the last reference is released.
+	// Content without reference count is kept, and ErrRefNotFound is returned.
+	Release(ctx context.Context, key string) error
+	// Service returns the underlying service, such as for URL of content keys.
+	Service() Service
+}
+
+// ContentStoreOptions configures the store created by NewContentStore.
+type ContentStoreOptions struct {
+	// Prefix of content keys, such as "blobs/". Default is "sha256/".
+	Prefix string
+	// RefCounter persists reference counts. Default is NewMemoryRefCounter().
+	RefCounter RefCounter
+	// TempDir buffers uploads to hash them before storing. Default is os.TempDir().
+	TempDir string
+}
+
+var _ ContentStore = (*contentStore)(nil)
+
+type contentStore struct {
+	service Service
+	prefix  string
+	refs    RefCounter
+	tempDir string
+	// locks serialize Put and Release of the same content in this process.
+	locks [64]sync.Mutex
+}
+
+// NewContentStore returns a content-addressable store on service.
+// Content keys look like "sha256/ab/cd/abcd...", the full hex SHA-256 sharded by its first bytes.
+func NewContentStore(service Service, options ...ContentStoreOptions) ContentStore {
+	s := &contentStore{
+		service: service,
+		prefix:  "sha256/",
+		refs:    NewMemoryRefCounter(),
+	}
+	for _, opt := range options {
+		if opt.Prefix != "" {
+			s.prefix = opt.Prefix
+		}
+		if opt.RefCounter != nil {
+			s.refs = opt.RefCounter
+		}
+		if opt.TempDir != "" {
+			s.tempDir = opt.TempDir
+		}
+	}
+
+	return s
+}
+
+func (s *contentStore) Put(ctx context.Context, reader io.Reader) (string, error) {
+	file, err := os.CreateTemp(s.tempDir, "storage-content-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), reader)
+	if err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	key := s.contentKey(sum)
+
+	mu := s.lock(sum)
+	mu.Lock()
+	defer mu.Unlock()
+
+	exist, err := s.service.Exist(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if !exist {
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return "", err
+		}
+		err = s.service.Upload(ctx, key, file)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	_, err = s.refs.Increment(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+func (s *contentStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if _, err := s.hashOf(key); err != nil {
+		return nil, err
+	}
+	return s.service.Download(ctx, key)
+}
+
+func (s *contentStore) Retain(ctx context.Context, key string) error {
+	sum, err := s.hashOf(key)
+	if err != nil {
+		return err
+	}
+
+	mu := s.lock(sum)
+	mu.Lock()
+	defer mu.Unlock()
+
+	exist, err := s.service.Exist(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return notExistError("retain", key)
+	}
+	_, err = s.refs.Increment(ctx, key)
+	return err
+}
+
+func (s *contentStore) Release(ctx context.Context, key string) error {
+	sum, err := s.hashOf(key)
+	if err != nil {
+		return err
+	}
+
+	mu := s.lock(sum)
+	mu.Lock()
+	defer mu.Unlock()
+
+	n, err := s.refs.Decrement(ctx, key)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	return s.service.Delete(ctx, key)
+}
+
+func (s *contentStore) Service() Service {
+	return s.service
+}
+
+func (s *contentStore) contentKey(sum string) string {
+	return s.prefix + sum[:2] + "/" + sum[2:4] + "/" + sum
+}
+
+// hashOf returns the hex SHA-256 of a content key.
+func (s *contentStore) hashOf(key string) (string, error) {
+	rest, ok := strings.CutPrefix(key, s.prefix)
+	if !ok {
+		return "", ErrInvalidContentKey
+	}
+	i := strings.LastIndex(rest, "/")
+	sum := rest[i+1:]
+	if len(sum) != sha256.Size*2 || s.contentKey(sum) != key {
+		return "", ErrInvalidContentKey
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return "", ErrInvalidContentKey
+	}
+	return sum, nil
+}
+
+func (s *contentStore) lock(sum string) *sync.Mutex {
+	b, _ := hex.DecodeString(sum[:2])
+	return &s.locks[int(b[0])%len(s.locks)]
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentStore(t *testing.T) {
+	t.Parallel()
+
+	backend, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	store := NewContentStore(backend, ContentStoreOptions{TempDir: t.TempDir()})
+	ctx := context.TODO()
+
+	key, err := store.Put(ctx, strings.NewReader("hello"))
+	require.NoError(t, err)
+	require.Equal(t, "sha256/2c/f2/2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", key)
+
+	// identical content is deduplicated
+	key2, err := store.Put(ctx, strings.NewReader("hello"))
+	require.NoError(t, err)
+	require.Equal(t, key, key2)
+
+	reader, err := store.Get(ctx, key)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, "hello", string(data))
+
+	// content is deleted with the last reference
+	require.NoError(t, store.Release(ctx, key))
+	exist, err := backend.Exist(ctx, key)
+	require.NoError(t, err)
+	require.True(t, exist)
+	require.NoError(t, store.Release(ctx, key))
+	exist, err = backend.Exist(ctx, key)
+	require.NoError(t, err)
+	require.False(t, exist)
+
+	require.ErrorIs(t, store.Retain(ctx, key), fs.ErrNotExist)
+
+	// content without count is kept, such as counts lost by a restart
+	key, err = store.Put(ctx, strings.NewReader("hello"))
+	require.NoError(t, err)
+	restarted := NewContentStore(backend, ContentStoreOptions{TempDir: t.TempDir()})
+	require.ErrorIs(t, restarted.Release(ctx, key), ErrRefNotFound)
+	exist, err = backend.Exist(ctx, key)
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	_, err = store.Get(ctx, "sha256/../secret")
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// KeyProvider provides key encryption keys for the service created by NewEncryptedService.
+// Keys must be 16, 24 or 32 bytes to select AES-128, AES-192 or AES-256.
+type KeyProvider interface {
+	// EncryptionKey returns the key and its ID to encrypt the object of the given storage key.
+	EncryptionKey(ctx context.Context, objectKey string) (keyID string, key []byte, err error)
+	// DecryptionKey returns the key of keyID.
+	DecryptionKey(ctx context.Context, keyID string) ([]byte, error)
+}
+
+// ErrKeyNotFound is returned by KeyProvider if the key does not exist.
+var ErrKeyNotFound = errors.New("encryption key not found")
+
+type keyRing struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewStaticKeyProvider returns a KeyProvider with a single key.
+func NewStaticKeyProvider(keyID string, key []byte) KeyProvider {
+	return NewKeyRing(keyID, map[string][]byte{keyID: key})
+}
+
+// NewKeyRing returns a KeyProvider supporting key rotation. New objects are encrypted with the key of current,
+// objects encrypted with any key in keys can be decrypted.
+func NewKeyRing(current string, keys map[string][]byte) KeyProvider {
+	return keyRing{
+		current: current,
+		keys:    keys,
+	}
+}
+
+func (r keyRing) EncryptionKey(ctx context.Context, objectKey string) (string, []byte, error) {
+	key, err := r.DecryptionKey(ctx, r.current)
+	return r.current, key, err
+}
+
+func (r keyRing) DecryptionKey(ctx context.Context, keyID string) ([]byte, error) {
+	key, ok := r.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+	}
+	return key, nil
+}
+
+type prefixKeyProvider struct {
+	prefixes  []string
+	providers map[string]KeyProvider
+}
+
+// NewPrefixKeyProvider returns a KeyProvider selecting the provider by the longest matching prefix of the object key.
+// Use "" as the prefix of the default provider. Key IDs must be unique among providers.
+func NewPrefixKeyProvider(providers map[string]KeyProvider) KeyProvider {
+	prefixes := make([]string, 0, len(providers))
+	for prefix := range providers {
+		prefixes = append(prefixes, prefix)
+	}
+	// longest prefix first
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) > len(prefixes[j])
+	})
+
+	return prefixKeyProvider{
+		prefixes:  prefixes,
+		providers: providers,
+	}
+}
+
+func (p prefixKeyProvider) EncryptionKey(ctx context.Context, objectKey string) (string, []byte, error) {
+	for _, prefix := range p.prefixes {
+		if strings.HasPrefix(objectKey, prefix) {
+			return p.providers[prefix].EncryptionKey(ctx, objectKey)
+		}
+	}
+	return "", nil, fmt.Errorf("%w: no key for %s", ErrKeyNotFound, objectKey)
+}
+
+func (p prefixKeyProvider) DecryptionKey(ctx context.Context, keyID string) ([]byte, error) {
+	for _, prefix := range p.prefixes {
+		key, err := p.providers[prefix].DecryptionKey(ctx, keyID)
+		if err == nil {
+			return key, nil
+		}
+		if !errors.Is(err, ErrKeyNotFound) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keyID)
+}
+
+const (
+	// encryptionChunkSize is the size of plaintext sealed in each chunk.
+	encryptionChunkSize = 64 << 10
+	// encryptionNoncePrefixSize leaves 4 bytes for the chunk counter and 1 byte for the last chunk flag.
+	encryptionNoncePrefixSize = 7
+)
+
+// newGCM returns AES-GCM of key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// wrapKey encrypts the data key with the key encryption key.
+func wrapKey(kek []byte, dataKey []byte) ([]byte, error) {
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+// unwrapKey decrypts the data key wrapped by wrapKey.
+func unwrapKey(kek []byte, wrapped []byte) ([]byte, error) {
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("invalid wrapped key")
+	}
+	nonce, ciphertext := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// chunkNonce returns the nonce of the i-th chunk. The last chunk uses a different nonce,
+// so truncating the ciphertext at a chunk boundary is detected.
+func chunkNonce(prefix []byte, i uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encryptionNoncePrefixSize:], i)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// decryptedSize returns the plaintext size of ciphertext of size.
+func decryptedSize(size int64) int64 {
+	sealed := int64(encryptionChunkSize + 16)
+	full, rest := size/sealed, size%sealed
+	if rest == 0 && full > 0 {
+		return full * encryptionChunkSize
+	}
+	return full*encryptionChunkSize + rest - 16
+}
+
+// encryptReader seals chunks of the source with AES-GCM.
+type encryptReader struct {
+	source *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	i      uint32
+	buf    []byte
+	out    []byte
+	done   bool
+}
+
+func newEncryptReader(source io.Reader, aead cipher.AEAD, prefix []byte) *encryptReader {
+	return &encryptReader{
+		source: bufio.NewReaderSize(source, encryptionChunkSize),
+		aead:   aead,
+		prefix: prefix,
+		buf:    make([]byte, encryptionChunkSize),
+	}
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		n, err := io.ReadFull(r.source, r.buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, err
+		}
+		last := err != nil
+		if !last {
+			// a full chunk is the last one if nothing follows
+			if _, err := r.source.Peek(1); err != nil {
+				if !errors.Is(err, io.EOF) {
+					return 0, err
+				}
+				last = true
+			}
+		}
+
+		r.out = r.aead.Seal(r.out[:0], chunkNonce(r.prefix, r.i, last), r.buf[:n], nil)
+		r.i++
+		r.done = last
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// decryptReader opens chunks sealed by encryptReader.
+type decryptReader struct {
+	source io.ReadCloser
+	reader *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	i      uint32
+	buf    []byte
+	out    []byte
+	done   bool
+}
+
+func newDecryptReader(source io.ReadCloser, aead cipher.AEAD, prefix []byte) *decryptReader {
+	return &decryptReader{
+		source: source,
+		reader: bufio.NewReaderSize(source, encryptionChunkSize+aead.Overhead()),
+		aead:   aead,
+		prefix: prefix,
+		buf:    make([]byte, encryptionChunkSize+aead.Overhead()),
+	}
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+
+		n, err := io.ReadFull(r.reader, r.buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, err
+		}
+		last := err != nil
+		if !last {
+			if _, err := r.reader.Peek(1); err != nil {
+				if !errors.Is(err, io.EOF) {
+					return 0, err
+				}
+				last = true
+			}
+		}
+
+		out, err := r.aead.Open(r.out[:0], chunkNonce(r.prefix, r.i, last), r.buf[:n], nil)
+		if err != nil {
+			return 0, fmt.Errorf("decrypt chunk %d: %w", r.i, err)
+		}
+		r.out = out
+		r.i++
+		r.done = last
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.source.Close()
+}
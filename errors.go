@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotSupported is returned by operations the service does not support.
+var ErrNotSupported = errors.New("not supported")
+
+// DeleteError describes a key that could not be deleted by DeleteBatch.
+type DeleteError struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+func (e DeleteError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("delete %s: %s", e.Key, e.Message)
+	}
+	return fmt.Sprintf("delete %s: %s: %s", e.Key, e.Code, e.Message)
+}
+
+// DeleteBatchError is returned by DeleteBatch when some of the keys could not be deleted.
+// Keys not listed in Errors were deleted successfully, unless it's joined with errors of requests failed to send,
+// such as by errors.Join, whose keys are not listed.
+type DeleteBatchError struct {
+	Errors []DeleteError
+}
+
+func (e *DeleteBatchError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d keys failed to delete: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Keys returns the keys failed to delete.
+func (e *DeleteBatchError) Keys() []string {
+	keys := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		keys[i] = err.Key
+	}
+	return keys
+}
+
+// newDeleteBatchError returns a *DeleteBatchError if any failure exists, otherwise nil.
+func newDeleteBatchError(failures ...[]DeleteError) error {
+	var errs []DeleteError
+	for _, f := range failures {
+		errs = append(errs, f...)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &DeleteBatchError{Errors: errs}
+}
@@ -33,7 +33,7 @@ func main() {
 
 	// custom ACL
 	ctx := storage.WithS3Private(context.TODO())
-	ctx = storage.WithS3ContentType(ctx, "text/plain")
+	ctx = storage.WithContentType(ctx, "text/plain")
 	err = service.Upload(ctx, "test/abc.txt", bytes.NewReader([]byte("hello world")))
 	if err != nil {
 		log.Fatal(err)
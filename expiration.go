@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const ctxTTL contextKey = "ttl"
+
+// WithTTL sets objects uploaded or copied to expire after ttl. Expired objects are treated as deleted
+// and removed by DeleteExpired, see StartSweeper.
+// Only disk and memory services support TTL per object, S3 and GCS return ErrNotSupported for uploads and copies
+// with TTL. For them, use SetExpiration for a prefix instead.
+func WithTTL(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, ctxTTL, ttl)
+}
+
+// expiresAtFromContext returns the expiration time of objects uploaded with ctx, or zero time.
+func expiresAtFromContext(ctx context.Context) time.Time {
+	if v, ok := ctx.Value(ctxTTL).(time.Duration); ok && v > 0 {
+		return time.Now().Add(v)
+	}
+	return time.Time{}
+}
+
+// checkTTLSupported returns ErrNotSupported if ctx has a TTL, for services without TTL per object.
+func checkTTLSupported(ctx context.Context) error {
+	if v, ok := ctx.Value(ctxTTL).(time.Duration); ok && v > 0 {
+		return fmt.Errorf("%w: TTL per object, use SetExpiration", ErrNotSupported)
+	}
+	return nil
+}
+
+// Expirer is implemented by services supporting WithTTL.
+type Expirer interface {
+	// DeleteExpired deletes expired objects and returns the number of objects deleted.
+	DeleteExpired(ctx context.Context) (int, error)
+}
+
+// DeleteExpired deletes expired objects of service. It returns ErrNotSupported if service doesn't implement Expirer.
+func DeleteExpired(ctx context.Context, service Service) (int, error) {
+	if e, ok := service.(Expirer); ok {
+		return e.DeleteExpired(ctx)
+	}
+	return 0, ErrNotSupported
+}
+
+// StartSweeper deletes expired objects of service every interval in background until ctx is done.
+// onError is called with errors of DeleteExpired, it may be nil.
+// service is usually the disk service itself, wrapping services don't implement Expirer.
+func StartSweeper(ctx context.Context, service Service, interval time.Duration, onError func(err error)) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_, err := DeleteExpired(ctx, service)
+				if err != nil && onError != nil {
+					onError(err)
+				}
+			}
+		}
+	}()
+}
+
+// Lifecycler is implemented by services expiring objects by prefix, such as S3 lifecycle rules.
+type Lifecycler interface {
+	// SetExpiration expires objects under prefix days after creation, replacing the expiration of prefix if set.
+	SetExpiration(ctx context.Context, prefix string, days int) error
+	// RemoveExpiration removes the expiration of prefix set by SetExpiration.
+	RemoveExpiration(ctx context.Context, prefix string) error
+}
+
+// SetExpiration expires objects of service under prefix days after creation.
+// It returns ErrNotSupported if service doesn't implement Lifecycler.
+func SetExpiration(ctx context.Context, service Service, prefix string, days int) error {
+	if l, ok := service.(Lifecycler); ok {
+		return l.SetExpiration(ctx, prefix, days)
+	}
+	return ErrNotSupported
+}
+
+// RemoveExpiration removes the expiration of prefix set by SetExpiration.
+// It returns ErrNotSupported if service doesn't implement Lifecycler.
+func RemoveExpiration(ctx context.Context, service Service, prefix string) error {
+	if l, ok := service.(Lifecycler); ok {
+		return l.RemoveExpiration(ctx, prefix)
+	}
+	return ErrNotSupported
+}
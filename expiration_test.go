@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryService_ttl(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	ctx := context.TODO()
+
+	require.NoError(t, service.Upload(WithTTL(ctx, time.Millisecond), "tmp/a.txt", strings.NewReader("a")))
+	require.NoError(t, service.Upload(WithTTL(ctx, time.Hour), "tmp/b.txt", strings.NewReader("b")))
+	require.NoError(t, service.Upload(ctx, "tmp/c.txt", strings.NewReader("c")))
+	// copies get the TTL of the context
+	require.NoError(t, service.Copy(WithTTL(ctx, time.Millisecond), "tmp/c.txt", "tmp/d.txt"))
+	info, err := Stat(ctx, service, "tmp/b.txt")
+	require.NoError(t, err)
+	require.False(t, info.ExpiresAt.IsZero())
+	time.Sleep(5 * time.Millisecond)
+
+	// expired objects are treated as deleted before sweeping
+	for _, key := range []string{"tmp/a.txt", "tmp/d.txt"} {
+		exist, err := service.Exist(ctx, key)
+		require.NoError(t, err)
+		require.False(t, exist, key)
+		_, err = service.Download(ctx, key)
+		require.ErrorIs(t, err, fs.ErrNotExist, key)
+	}
+
+	n, err := DeleteExpired(ctx, service)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	var keys []string
+	err = List(ctx, service, "tmp/", func(obj ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"tmp/b.txt", "tmp/c.txt"}, keys)
+}
+
+func TestStartSweeper(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	require.NoError(t, service.Upload(WithTTL(ctx, time.Millisecond), "a.txt", strings.NewReader("a")))
+	StartSweeper(ctx, service, time.Millisecond, func(err error) {
+		t.Error(err)
+	})
+	m := service.(*memory)
+	require.Eventually(t, func() bool {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		// expired objects are kept until swept
+		_, ok := m.objects["a.txt"]
+		return !ok
+	}, time.Second, time.Millisecond)
+
+	// services without Expirer report errors
+	errs := make(chan error, 1)
+	StartSweeper(ctx, NewNullService(), time.Millisecond, func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	select {
+	case err := <-errs:
+		require.ErrorIs(t, err, ErrNotSupported)
+	case <-time.After(time.Second):
+		t.Fatal("sweeper didn't run")
+	}
+}
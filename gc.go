@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+)
+
+// GCOptions configures CollectGarbage.
+type GCOptions struct {
+	// Prefixes to scan, such as "uploads/". Default is all objects.
+	Prefixes []string
+	// IsReferenced reports whether an object is referenced, such as by ReferencedByBlobs. Required.
+	// Variants are referenced while their origin object is referenced or within the grace period,
+	// so variants of orphans are deleted along with them. Variants are not passed to IsReferenced.
+	IsReferenced func(ctx context.Context, key string) (bool, error)
+	// GracePeriod keeps objects modified recently, such as uploads not recorded yet. Default is 24 hours.
+	// Objects listed without LastModified are always kept.
+	GracePeriod time.Duration
+	// DryRun logs and returns unreferenced objects without deleting them.
+	DryRun bool
+	// DeletesPerSecond limits the rate of deletion. Zero means unlimited.
+	DeletesPerSecond float64
+	// BatchSize is the number of keys deleted by a DeleteBatch. Default is 100.
+	BatchSize int
+	// Logger receives a record for every unreferenced object. Default is slog.Default().
+	Logger *slog.Logger
+}
+
+// GCResult is the result of CollectGarbage.
+type GCResult struct {
+	// Scanned is the number of objects listed.
+	Scanned int
+	// Orphans are unreferenced objects older than the grace period, deleted unless DryRun.
+	Orphans []string
+}
+
+// ReferencedByBlobs returns a GCOptions.IsReferenced func treating objects with a blob as referenced.
+func ReferencedByBlobs(blobs BlobStore) func(ctx context.Context, key string) (bool, error) {
+	return func(ctx context.Context, key string) (bool, error) {
+		_, err := blobs.Find(ctx, key)
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+}
+
+// ReferencedByAttachments returns a GCOptions.IsReferenced func treating objects attached to records as referenced.
+func ReferencedByAttachments(attachments AttachmentStore) func(ctx context.Context, key string) (bool, error) {
+	return attachments.Referenced
+}
+
+// CollectGarbage deletes objects of service not referenced and not modified within the grace period.
+// service must implement Lister. Orphans found before an error are returned with the error.
+func CollectGarbage(ctx context.Context, service Service, options GCOptions) (GCResult, error) {
+	if options.IsReferenced == nil {
+		return GCResult{}, errors.New("gc: IsReferenced is required")
+	}
+	if len(options.Prefixes) == 0 {
+		options.Prefixes = []string{""}
+	}
+	if options.GracePeriod == 0 {
+		options.GracePeriod = 24 * time.Hour
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 100
+	}
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+
+	var result GCResult
+	cutoff := time.Now().Add(-options.GracePeriod)
+	// reachability of origins of variants, shared by prefixes
+	origins := make(map[string]bool)
+	for _, prefix := range options.Prefixes {
+		var orphans []string
+		err := List(ctx, service, prefix, func(obj ObjectInfo) error {
+			result.Scanned++
+			if recent(obj.LastModified, cutoff) {
+				return nil
+			}
+
+			referenced, err := isReferenced(ctx, service, obj.Key, cutoff, options.IsReferenced, origins)
+			if err != nil || referenced {
+				return err
+			}
+
+			options.Logger.LogAttrs(ctx, slog.LevelInfo, "storage orphan object",
+				slog.String("key", obj.Key),
+				slog.Int64("bytes", obj.Size),
+				slog.Time("last_modified", obj.LastModified),
+				slog.Bool("dry_run", options.DryRun),
+			)
+			orphans = append(orphans, obj.Key)
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+
+		if !options.DryRun {
+			err = deleteRateLimited(ctx, service, orphans, options.BatchSize, options.DeletesPerSecond)
+		}
+		result.Orphans = append(result.Orphans, orphans...)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// isReferenced reports whether key is referenced by fn, variants by the reachability of their origin
+// cached in origins.
+func isReferenced(ctx context.Context, service Service, key string, cutoff time.Time,
+	fn func(ctx context.Context, key string) (bool, error), origins map[string]bool) (bool, error) {
+	rest, ok := strings.CutPrefix(key, "variants/")
+	if !ok {
+		return fn(ctx, key)
+	}
+
+	// variants are named "variants/<dir>/<base>-<digest>.<format>" after "<dir>/<base>.<ext>"
+	dir, file := path.Split(rest)
+	i := strings.LastIndex(file, "-")
+	if i < 0 || !variantKeyPattern.MatchString(file[i+1:]) {
+		return fn(ctx, key)
+	}
+	origin := dir + file[:i]
+	if reachable, ok := origins[origin]; ok {
+		return reachable, nil
+	}
+
+	// the origin of "photo" is "photo" with any extension, such as "photo.jpg" but not "photo.v2.jpg",
+	// and it's reachable if any of them is
+	reachable := false
+	err := List(ctx, service, origin, func(obj ObjectInfo) error {
+		if obj.Key != origin && strings.TrimSuffix(obj.Key, path.Ext(obj.Key)) != origin {
+			return nil
+		}
+		reachable = recent(obj.LastModified, cutoff)
+		if !reachable {
+			referenced, err := fn(ctx, obj.Key)
+			if err != nil {
+				return err
+			}
+			reachable = referenced
+		}
+		if reachable {
+			return errStopList
+		}
+		return nil
+	})
+	if errors.Is(err, errStopList) {
+		err = nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	origins[origin] = reachable
+	return reachable, nil
+}
+
+// recent reports whether an object modified at t is within the grace period. Unknown times are treated
+// as recent, so objects of backends not reporting them are kept.
+func recent(t time.Time, cutoff time.Time) bool {
+	return t.IsZero() || t.After(cutoff)
+}
+
+var errStopList = errors.New("stop list")
+
+func deleteRateLimited(ctx context.Context, service Service, keys []string, batchSize int, perSecond float64) error {
+	if perSecond > 0 && float64(batchSize) > perSecond {
+		batchSize = max(1, int(perSecond))
+	}
+	for i, batch := range chunkStrings(keys, batchSize) {
+		if i > 0 && perSecond > 0 {
+			wait := time.Duration(float64(len(batch)) / perSecond * float64(time.Second))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+
+		err := service.DeleteBatch(ctx, batch)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	store := New(service, nil)
+	ctx := context.TODO()
+
+	blob, err := store.Create(ctx, strings.NewReader("kept"), "kept.jpg")
+	require.NoError(t, err)
+	variant := store.Variant(blob.Key, VariantOptions{}.SetSize(100))
+	require.NoError(t, service.Upload(ctx, variant.Key(), strings.NewReader("variant")))
+	require.NoError(t, service.Upload(ctx, "orphan.jpg", strings.NewReader("orphan")))
+	// variants of orphans are collected in the same run
+	orphanOriginVariant := store.Variant("orphan.jpg", VariantOptions{}.SetSize(100))
+	require.NoError(t, service.Upload(ctx, orphanOriginVariant.Key(), strings.NewReader("variant")))
+	orphanVariant := store.Variant("orphan2.jpg", VariantOptions{}.SetSize(100))
+	require.NoError(t, service.Upload(ctx, orphanVariant.Key(), strings.NewReader("variant")))
+	time.Sleep(time.Millisecond)
+
+	options := GCOptions{
+		IsReferenced: ReferencedByBlobs(store.Blobs()),
+		GracePeriod:  time.Nanosecond,
+		DryRun:       true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	result, err := CollectGarbage(ctx, service, options)
+	require.NoError(t, err)
+	require.Equal(t, 5, result.Scanned)
+	require.ElementsMatch(t, []string{"orphan.jpg", orphanOriginVariant.Key(), orphanVariant.Key()}, result.Orphans)
+	exist, err := service.Exist(ctx, "orphan.jpg")
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	// recent objects are kept
+	options.GracePeriod = time.Hour
+	result, err = CollectGarbage(ctx, service, options)
+	require.NoError(t, err)
+	require.Empty(t, result.Orphans)
+
+	options.GracePeriod = time.Nanosecond
+	options.DryRun = false
+	_, err = CollectGarbage(ctx, service, options)
+	require.NoError(t, err)
+	for key, want := range map[string]bool{"orphan.jpg": false, orphanOriginVariant.Key(): false, orphanVariant.Key(): false, blob.Key: true, variant.Key(): true} {
+		exist, err := service.Exist(ctx, key)
+		require.NoError(t, err)
+		require.Equal(t, want, exist, key)
+	}
+}
+
+// zeroTimeService lists objects without LastModified.
+type zeroTimeService struct {
+	Service
+}
+
+func (s zeroTimeService) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	return List(ctx, s.Service, prefix, func(obj ObjectInfo) error {
+		obj.LastModified = time.Time{}
+		return fn(obj)
+	})
+}
+
+func TestCollectGarbage_origins(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	store := New(service, nil)
+	ctx := context.TODO()
+
+	// "photo.v2.jpg" is referenced, but it isn't the origin of variants of "photo.jpg"
+	require.NoError(t, service.Upload(ctx, "photo.v2.jpg", strings.NewReader("v2")))
+	variant := store.Variant("photo.jpg", VariantOptions{}.SetSize(100))
+	require.NoError(t, service.Upload(ctx, variant.Key(), strings.NewReader("variant")))
+	time.Sleep(time.Millisecond)
+
+	options := GCOptions{
+		IsReferenced: func(ctx context.Context, key string) (bool, error) {
+			return key == "photo.v2.jpg", nil
+		},
+		GracePeriod: time.Nanosecond,
+		DryRun:      true,
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	result, err := CollectGarbage(ctx, service, options)
+	require.NoError(t, err)
+	require.Equal(t, []string{variant.Key()}, result.Orphans)
+
+	// objects of unknown age are kept
+	result, err = CollectGarbage(ctx, zeroTimeService{service}, options)
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Scanned)
+	require.Empty(t, result.Orphans)
+}
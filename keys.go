@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KeyGenerator generates keys for new files.
+type KeyGenerator interface {
+	// GenerateKey returns a key for a file named filename, such as "photo.JPG".
+	// The extension of filename is kept in lower case, so MimeTypeByExtension and variants keep working.
+	// content is only read by generators deriving keys from content, it may be nil otherwise.
+	GenerateKey(ctx context.Context, filename string, content io.Reader) (string, error)
+}
+
+// KeyGeneratorFunc is an adapter to use functions as KeyGenerator.
+type KeyGeneratorFunc func(ctx context.Context, filename string, content io.Reader) (string, error)
+
+func (f KeyGeneratorFunc) GenerateKey(ctx context.Context, filename string, content io.Reader) (string, error) {
+	return f(ctx, filename, content)
+}
+
+const base36Alphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// RandomKeys returns a KeyGenerator generating random base36 tokens of 28 characters like ActiveStorage,
+// such as "xtapjjcjiudrlk3tmwyjgpuobabd.jpg".
+func RandomKeys() KeyGenerator {
+	return idKeys(func() (string, error) {
+		return randomBase36(28)
+	})
+}
+
+// UUIDKeys returns a KeyGenerator generating random UUIDv4, such as "f47ac10b-58cc-4372-a567-0e02b2c3d479.jpg".
+func UUIDKeys() KeyGenerator {
+	return idKeys(func() (string, error) {
+		id, err := uuid.NewRandom()
+		if err != nil {
+			return "", err
+		}
+		return id.String(), nil
+	})
+}
+
+// ULIDKeys returns a KeyGenerator generating ULIDs, which sort by creation time, such as "01arz3ndektsv4rrffq69g5fav.jpg".
+// ULIDs are lower cased to keep keys in lower case.
+func ULIDKeys() KeyGenerator {
+	return idKeys(func() (string, error) {
+		return newULID(time.Now())
+	})
+}
+
+// ContentHashKeys returns a KeyGenerator using the hex SHA-256 of content as key.
+// content must implement io.Seeker, it's rewound after hashing.
+func ContentHashKeys() KeyGenerator {
+	return KeyGeneratorFunc(func(ctx context.Context, filename string, content io.Reader) (string, error) {
+		seeker, ok := content.(io.ReadSeeker)
+		if !ok {
+			return "", errors.New("content hash keys need io.ReadSeeker")
+		}
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return "", err
+		}
+
+		hash := sha256.New()
+		_, err = io.Copy(hash, seeker)
+		if err != nil {
+			return "", err
+		}
+		_, err = seeker.Seek(start, io.SeekStart)
+		if err != nil {
+			return "", err
+		}
+
+		return hex.EncodeToString(hash.Sum(nil)) + extension(filename), nil
+	})
+}
+
+// DatePartitionedKeys returns a KeyGenerator prefixing keys of generator by the current UTC date,
+// such as "2026/10/16/xtapjjcjiudrlk3tmwyjgpuobabd.jpg".
+func DatePartitionedKeys(generator KeyGenerator) KeyGenerator {
+	return KeyGeneratorFunc(func(ctx context.Context, filename string, content io.Reader) (string, error) {
+		key, err := generator.GenerateKey(ctx, filename, content)
+		if err != nil {
+			return "", err
+		}
+		return time.Now().UTC().Format("2006/01/02/") + key, nil
+	})
+}
+
+func idKeys(newID func() (string, error)) KeyGenerator {
+	return KeyGeneratorFunc(func(ctx context.Context, filename string, content io.Reader) (string, error) {
+		id, err := newID()
+		if err != nil {
+			return "", err
+		}
+		return id + extension(filename), nil
+	})
+}
+
+// extension returns the lower cased extension of filename.
+func extension(filename string) string {
+	return strings.ToLower(path.Ext(path.Base(strings.ReplaceAll(filename, "\\", "/"))))
+}
+
+// randomBase36 returns n random base36 characters from crypto/rand.
+func randomBase36(n int) (string, error) {
+	token := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(token) < n {
+		_, err := rand.Read(buf)
+		if err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			// reject bytes biasing the distribution
+			if b >= 252 {
+				continue
+			}
+			token = append(token, base36Alphabet[b%36])
+			if len(token) == n {
+				break
+			}
+		}
+	}
+	return string(token), nil
+}
+
+const crockfordAlphabet = "0123456789abcdefghjkmnpqrstvwxyz"
+
+// newULID returns a ULID of t, 48 bits of milliseconds and 80 random bits in Crockford's base32.
+func newULID(t time.Time) (string, error) {
+	var id [16]byte
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(t.UnixMilli()))
+	copy(id[:6], ms[2:])
+	_, err := rand.Read(id[6:])
+	if err != nil {
+		return "", err
+	}
+
+	// 128 bits encode to 26 characters, the first one carries 3 bits
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordAlphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out), nil
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyGenerators(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.TODO()
+	tests := []struct {
+		generator KeyGenerator
+		pattern   string
+	}{
+		{RandomKeys(), `^[0-9a-z]{28}\.jpg$`},
+		{UUIDKeys(), `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}\.jpg$`},
+		{ULIDKeys(), `^[0-7][0-9a-hjkmnp-tv-z]{25}\.jpg$`},
+		{DatePartitionedKeys(RandomKeys()), `^\d{4}/\d{2}/\d{2}/[0-9a-z]{28}\.jpg$`},
+	}
+	for _, tt := range tests {
+		key, err := tt.generator.GenerateKey(ctx, "dir/Photo.JPG", nil)
+		require.NoError(t, err)
+		require.Regexp(t, regexp.MustCompile(tt.pattern), key)
+		require.Equal(t, "image/jpeg", MimeTypeByExtension(key[strings.LastIndex(key, "."):]))
+	}
+
+	content := strings.NewReader("hello")
+	key, err := ContentHashKeys().GenerateKey(ctx, "a.txt", content)
+	require.NoError(t, err)
+	require.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824.txt", key)
+	require.Equal(t, 5, content.Len())
+
+	// ULIDs sort by time
+	a, err := newULID(time.UnixMilli(1))
+	require.NoError(t, err)
+	b, err := newULID(time.UnixMilli(2))
+	require.NoError(t, err)
+	require.Less(t, a, b)
+	require.Equal(t, "0000000001", a[:10])
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+	// OutcomeHit and OutcomeMiss are reported by the service created by NewCacheService.
+	OutcomeHit  = "hit"
+	OutcomeMiss = "miss"
+)
+
+// OperationMetric describes a finished storage operation.
+type OperationMetric struct {
+	// Operation is the name of the operation, such as "upload" or "variant.process".
+	Operation string
+	// Backend is the name of the service, such as "s3", "gcs" or "disk".
+	Backend  string
+	Duration time.Duration
+	// Bytes is the number of bytes uploaded or downloaded.
+	Bytes int64
+	// Outcome is OutcomeSuccess, OutcomeError, OutcomeHit or OutcomeMiss.
+	Outcome string
+}
+
+// Metrics records metrics of storage operations.
+type Metrics interface {
+	Record(metric OperationMetric)
+}
+
+// MetricsFunc is an adapter to allow the use of ordinary functions as Metrics.
+type MetricsFunc func(metric OperationMetric)
+
+func (f MetricsFunc) Record(metric OperationMetric) {
+	f(metric)
+}
+
+var expvarMetricsMu sync.Mutex
+
+type expvarMetric struct {
+	vars *expvar.Map
+}
+
+// NewExpvarMetrics creates Metrics published as expvar name.
+//
+// Values are grouped by backend and operation, such as "s3" -> "upload" -> {"count", "errors", "bytes", "duration_ns"}.
+// Cache operations count "hits" and "misses" as well.
+// Metrics created with the same name share the same values, including a map published as name by other packages.
+// If name is published as another type of expvar, values are recorded but not published.
+func NewExpvarMetrics(name string) Metrics {
+	expvarMetricsMu.Lock()
+	defer expvarMetricsMu.Unlock()
+
+	switch v := expvar.Get(name).(type) {
+	case nil:
+		return expvarMetric{vars: expvar.NewMap(name)}
+	case *expvar.Map:
+		return expvarMetric{vars: v}
+	default:
+		return expvarMetric{vars: new(expvar.Map)}
+	}
+}
+
+func (m expvarMetric) Record(metric OperationMetric) {
+	backend := childMap(m.vars, metric.Backend)
+	op := childMap(backend, metric.Operation)
+	op.Add("count", 1)
+	switch metric.Outcome {
+	case OutcomeError:
+		op.Add("errors", 1)
+	case OutcomeHit:
+		op.Add("hits", 1)
+	case OutcomeMiss:
+		op.Add("misses", 1)
+	}
+	op.Add("bytes", metric.Bytes)
+	op.Add("duration_ns", int64(metric.Duration))
+}
+
+var childMapMu sync.Mutex
+
+func childMap(parent *expvar.Map, key string) *expvar.Map {
+	if m, ok := parent.Get(key).(*expvar.Map); ok {
+		return m
+	}
+
+	childMapMu.Lock()
+	defer childMapMu.Unlock()
+	if m, ok := parent.Get(key).(*expvar.Map); ok {
+		return m
+	}
+	m := new(expvar.Map).Init()
+	parent.Set(key, m)
+	return m
+}
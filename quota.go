@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"sync"
+)
+
+// Usage is the storage used under a prefix.
+type Usage struct {
+	Bytes   int64
+	Objects int64
+}
+
+// Quota limits the usage under a prefix. Zero means unlimited.
+type Quota struct {
+	MaxBytes   int64
+	MaxObjects int64
+}
+
+// UsageStore persists usage of prefixes for the service created by NewQuotaService.
+// Implementations must be safe for concurrent use.
+type UsageStore interface {
+	Get(ctx context.Context, prefix string) (Usage, error)
+	// Add adds delta to the usage of prefix.
+	Add(ctx context.Context, prefix string, delta Usage) error
+	// Set replaces the usage of prefix.
+	Set(ctx context.Context, prefix string, usage Usage) error
+}
+
+type memoryUsageStore struct {
+	mu     sync.Mutex
+	usages map[string]Usage
+}
+
+// NewMemoryUsageStore returns a UsageStore keeping usage in memory.
+func NewMemoryUsageStore() UsageStore {
+	return &memoryUsageStore{
+		usages: make(map[string]Usage),
+	}
+}
+
+func (s *memoryUsageStore) Get(ctx context.Context, prefix string) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usages[prefix], nil
+}
+
+func (s *memoryUsageStore) Add(ctx context.Context, prefix string, delta Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.usages[prefix]
+	u.Bytes += delta.Bytes
+	u.Objects += delta.Objects
+	s.usages[prefix] = u
+	return nil
+}
+
+func (s *memoryUsageStore) Set(ctx context.Context, prefix string, usage Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usages[prefix] = usage
+	return nil
+}
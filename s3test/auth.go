@@ -0,0 +1,228 @@
+package s3test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Credentials of Config, the only ones accepted by the server.
+const (
+	accessKeyID     = "AKIDS3TEST"
+	secretAccessKey = "s3test"
+)
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	// maxSkew is the allowed difference between the clock of the server and the date of signed headers.
+	maxSkew = 15 * time.Minute
+	// maxExpires is the longest expiration of presigned URLs, 7 days.
+	maxExpires = 7 * 24 * 60 * 60
+)
+
+// signature is the SigV4 signature of a request, from the Authorization header or the query of a presigned URL.
+type signature struct {
+	credential    string
+	signedHeaders []string
+	signature     string
+	date          time.Time
+	// payloadHash is the hash signed for the body, the body itself is not verified.
+	payloadHash string
+	presigned   bool
+}
+
+// authenticate verifies the SigV4 signature of r, or writes an error. Requests without signature are only
+// allowed to read public-read objects, which is checked by the caller, so it returns false, true for them.
+func authenticate(w http.ResponseWriter, r *http.Request) (signed bool, ok bool) {
+	sig, err := parseSignature(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "AuthorizationQueryParametersError", err.Error())
+		return false, false
+	}
+	if sig == nil {
+		return false, true
+	}
+
+	accessKey, scope, _ := strings.Cut(sig.credential, "/")
+	if accessKey != accessKeyID {
+		writeError(w, http.StatusForbidden, "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records")
+		return true, false
+	}
+	now := time.Now().UTC()
+	if sig.presigned {
+		expires, err := strconv.Atoi(r.URL.Query().Get("X-Amz-Expires"))
+		if err != nil || expires < 1 || expires > maxExpires {
+			writeError(w, http.StatusBadRequest, "AuthorizationQueryParametersError", "X-Amz-Expires must be between 1 and 604800 seconds")
+			return true, false
+		}
+		if now.After(sig.date.Add(time.Duration(expires) * time.Second)) {
+			writeError(w, http.StatusForbidden, "AccessDenied", "Request has expired")
+			return true, false
+		}
+	} else if now.Sub(sig.date).Abs() > maxSkew {
+		writeError(w, http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the current time is too large")
+		return true, false
+	}
+	if !containsHeader(sig.signedHeaders, "host") {
+		writeError(w, http.StatusForbidden, "AccessDenied", "Host must be a signed header")
+		return true, false
+	}
+
+	stringToSign := strings.Join([]string{
+		signingAlgorithm,
+		sig.date.Format(amzDateFormat),
+		scope,
+		hashHex(canonicalRequest(r, sig)),
+	}, "\n")
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range strings.Split(scope, "/") {
+		key = hmacSHA256(key, part)
+	}
+	expected := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if !hmac.Equal([]byte(expected), []byte(sig.signature)) {
+		writeError(w, http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided")
+		return true, false
+	}
+	return true, true
+}
+
+// parseSignature returns the signature of r, nil if r is anonymous.
+func parseSignature(r *http.Request) (*signature, error) {
+	query := r.URL.Query()
+	if query.Has("X-Amz-Signature") {
+		if query.Get("X-Amz-Algorithm") != signingAlgorithm {
+			return nil, fmt.Errorf("unsupported X-Amz-Algorithm %q", query.Get("X-Amz-Algorithm"))
+		}
+		for _, name := range []string{"X-Amz-Credential", "X-Amz-Date", "X-Amz-Expires", "X-Amz-SignedHeaders"} {
+			if query.Get(name) == "" {
+				return nil, fmt.Errorf("%s is required by presigned URLs", name)
+			}
+		}
+		date, err := time.Parse(amzDateFormat, query.Get("X-Amz-Date"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid X-Amz-Date %q", query.Get("X-Amz-Date"))
+		}
+		payloadHash := query.Get("X-Amz-Content-Sha256")
+		if payloadHash == "" {
+			payloadHash = "UNSIGNED-PAYLOAD"
+		}
+		return &signature{
+			credential:    query.Get("X-Amz-Credential"),
+			signedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+			signature:     query.Get("X-Amz-Signature"),
+			date:          date,
+			payloadHash:   payloadHash,
+			presigned:     true,
+		}, nil
+	}
+
+	authorization := r.Header.Get("Authorization")
+	if authorization == "" {
+		return nil, nil
+	}
+	fields, ok := strings.CutPrefix(authorization, signingAlgorithm+" ")
+	if !ok {
+		return nil, fmt.Errorf("unsupported Authorization %q", authorization)
+	}
+	sig := &signature{payloadHash: r.Header.Get("X-Amz-Content-Sha256")}
+	for _, field := range strings.Split(fields, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch name {
+		case "Credential":
+			sig.credential = value
+		case "SignedHeaders":
+			sig.signedHeaders = strings.Split(value, ";")
+		case "Signature":
+			sig.signature = value
+		}
+	}
+	if sig.credential == "" || len(sig.signedHeaders) == 0 || sig.signature == "" {
+		return nil, errors.New("Authorization requires Credential, SignedHeaders and Signature")
+	}
+	if sig.payloadHash == "" {
+		return nil, errors.New("X-Amz-Content-Sha256 is required")
+	}
+	date, err := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid X-Amz-Date %q", r.Header.Get("X-Amz-Date"))
+	}
+	sig.date = date
+	return sig, nil
+}
+
+func canonicalRequest(r *http.Request, sig *signature) string {
+	// the path as sent, S3 paths are not escaped twice
+	path, _, _ := strings.Cut(r.RequestURI, "?")
+
+	var query []string
+	for name, values := range r.URL.Query() {
+		if sig.presigned && name == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range values {
+			query = append(query, escape(name)+"="+escape(value))
+		}
+	}
+	sort.Strings(query)
+
+	var headers strings.Builder
+	for _, name := range sig.signedHeaders {
+		var value string
+		switch name {
+		case "host":
+			value = r.Host
+		case "content-length":
+			value = strconv.FormatInt(r.ContentLength, 10)
+		default:
+			var values []string
+			for _, v := range r.Header.Values(name) {
+				values = append(values, strings.Join(strings.Fields(v), " "))
+			}
+			value = strings.Join(values, ",")
+		}
+		headers.WriteString(name + ":" + value + "\n")
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		path,
+		strings.Join(query, "&"),
+		headers.String(),
+		strings.Join(sig.signedHeaders, ";"),
+		sig.payloadHash,
+	}, "\n")
+}
+
+// escape encodes s by RFC 3986, as required by canonical queries.
+func escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func containsHeader(headers []string, name string) bool {
+	for _, h := range headers {
+		if h == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hashHex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
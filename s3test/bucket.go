@@ -0,0 +1,225 @@
+package s3test
+
+import (
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	KeyCount              int            `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []listObject   `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type listObject struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// listObjectsV2 lists keys in order, continuation tokens are the last key or common prefix returned.
+func (s *Server) listObjectsV2(w http.ResponseWriter, r *http.Request, name string, b *bucket) {
+	query := r.URL.Query()
+	if query.Get("list-type") != "2" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "Only ListObjectsV2 is supported")
+		return
+	}
+
+	result := listBucketResult{
+		Name:              name,
+		Prefix:            query.Get("prefix"),
+		Delimiter:         query.Get("delimiter"),
+		StartAfter:        query.Get("start-after"),
+		ContinuationToken: query.Get("continuation-token"),
+		MaxKeys:           1000,
+	}
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", "Invalid max-keys")
+			return
+		}
+		result.MaxKeys = min(n, 1000)
+	}
+	marker := result.StartAfter
+	if result.ContinuationToken != "" {
+		marker = result.ContinuationToken
+	}
+
+	last := ""
+	for _, key := range b.keys(result.Prefix) {
+		if key <= marker || (strings.HasSuffix(marker, result.Delimiter) && result.Delimiter != "" && strings.HasPrefix(key, marker)) {
+			continue
+		}
+
+		entry := key
+		if result.Delimiter != "" {
+			if i := strings.Index(key[len(result.Prefix):], result.Delimiter); i >= 0 {
+				entry = key[:len(result.Prefix)+i+len(result.Delimiter)]
+			}
+		}
+		if entry == last {
+			continue
+		}
+		if result.KeyCount == result.MaxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = last
+			break
+		}
+
+		if entry != key {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: entry})
+		} else {
+			obj := b.latest(key)
+			result.Contents = append(result.Contents, listObject{
+				Key:          key,
+				LastModified: formatTime(obj.LastModified),
+				ETag:         obj.ETag,
+				Size:         len(obj.Data),
+				StorageClass: obj.StorageClass,
+			})
+		}
+		result.KeyCount++
+		last = entry
+	}
+
+	writeXML(w, http.StatusOK, result)
+}
+
+type listVersionsResult struct {
+	XMLName       xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListVersionsResult"`
+	Name          string         `xml:"Name"`
+	Prefix        string         `xml:"Prefix"`
+	MaxKeys       int            `xml:"MaxKeys"`
+	IsTruncated   bool           `xml:"IsTruncated"`
+	Versions      []listVersion  `xml:"Version"`
+	DeleteMarkers []deleteMarker `xml:"DeleteMarker"`
+}
+
+type listVersion struct {
+	Key          string `xml:"Key"`
+	VersionID    string `xml:"VersionId"`
+	IsLatest     bool   `xml:"IsLatest"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type deleteMarker struct {
+	Key          string `xml:"Key"`
+	VersionID    string `xml:"VersionId"`
+	IsLatest     bool   `xml:"IsLatest"`
+	LastModified string `xml:"LastModified"`
+}
+
+// listVersions lists all versions of keys with prefix in one page, newest first.
+func (s *Server) listVersions(w http.ResponseWriter, r *http.Request, name string, b *bucket) {
+	prefix := r.URL.Query().Get("prefix")
+	result := listVersionsResult{Name: name, Prefix: prefix, MaxKeys: 1000}
+
+	var keys []string
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		versions := b.objects[key]
+		for i := len(versions) - 1; i >= 0; i-- {
+			obj := versions[i]
+			latest := i == len(versions)-1
+			if obj.DeleteMarker {
+				result.DeleteMarkers = append(result.DeleteMarkers, deleteMarker{
+					Key:          key,
+					VersionID:    obj.VersionID,
+					IsLatest:     latest,
+					LastModified: formatTime(obj.LastModified),
+				})
+				continue
+			}
+			result.Versions = append(result.Versions, listVersion{
+				Key:          key,
+				VersionID:    obj.VersionID,
+				IsLatest:     latest,
+				LastModified: formatTime(obj.LastModified),
+				ETag:         obj.ETag,
+				Size:         len(obj.Data),
+				StorageClass: obj.StorageClass,
+			})
+		}
+	}
+
+	writeXML(w, http.StatusOK, result)
+}
+
+type deleteRequest struct {
+	Quiet   bool `xml:"Quiet"`
+	Objects []struct {
+		Key       string `xml:"Key"`
+		VersionID string `xml:"VersionId"`
+	} `xml:"Object"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name        `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult"`
+	Deleted []deletedObject `xml:"Deleted"`
+}
+
+type deletedObject struct {
+	Key                   string `xml:"Key"`
+	VersionID             string `xml:"VersionId,omitempty"`
+	DeleteMarker          bool   `xml:"DeleteMarker,omitempty"`
+	DeleteMarkerVersionID string `xml:"DeleteMarkerVersionId,omitempty"`
+}
+
+func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request, b *bucket) {
+	var request deleteRequest
+	if !decodeXML(w, r, &request) {
+		return
+	}
+	if len(request.Objects) > 1000 {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "The request must not contain more than 1000 keys")
+		return
+	}
+
+	var result deleteResult
+	for _, o := range request.Objects {
+		versionID, marker := s.remove(b, o.Key, o.VersionID)
+		if request.Quiet {
+			continue
+		}
+		deleted := deletedObject{Key: o.Key, VersionID: o.VersionID}
+		if o.VersionID == "" && marker {
+			deleted.DeleteMarker = true
+			deleted.DeleteMarkerVersionID = versionID
+		}
+		result.Deleted = append(result.Deleted, deleted)
+	}
+	writeXML(w, http.StatusOK, result)
+}
+
+type versioningConfiguration struct {
+	XMLName xml.Name `xml:"VersioningConfiguration"`
+	Status  string   `xml:"Status,omitempty"`
+}
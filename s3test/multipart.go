@@ -0,0 +1,135 @@
+package s3test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// minPartSize is the minimum size of parts except the last one.
+const minPartSize = 5 << 20
+
+type upload struct {
+	key    string
+	header http.Header
+	parts  map[int][]byte
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+func (s *Server) serveMultipart(w http.ResponseWriter, r *http.Request, bucketName string, b *bucket, key string) {
+	query := r.URL.Query()
+	if r.Method == http.MethodPost && query.Has("uploads") {
+		s.seq++
+		id := fmt.Sprintf("upload-%08d", s.seq)
+		b.uploads[id] = &upload{key: key, header: r.Header.Clone(), parts: make(map[int][]byte)}
+		writeXML(w, http.StatusOK, initiateMultipartUploadResult{Bucket: bucketName, Key: key, UploadID: id})
+		return
+	}
+
+	id := query.Get("uploadId")
+	u, ok := b.uploads[id]
+	if !ok || u.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			writeError(w, http.StatusNotImplemented, "NotImplemented", "UploadPartCopy is not supported")
+			return
+		}
+		number, err := strconv.Atoi(query.Get("partNumber"))
+		if err != nil || number < 1 || number > 10000 {
+			writeError(w, http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000")
+			return
+		}
+		data, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		u.parts[number] = data
+		w.Header().Set("ETag", etag(data))
+	case http.MethodPost:
+		s.completeMultipartUpload(w, r, bucketName, b, id, u)
+	case http.MethodDelete:
+		delete(b.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "The operation is not supported")
+	}
+}
+
+func (s *Server) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucketName string, b *bucket, id string, u *upload) {
+	var request completeMultipartUpload
+	if !decodeXML(w, r, &request) {
+		return
+	}
+	if len(request.Parts) == 0 {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "The request must contain at least one part")
+		return
+	}
+
+	var data []byte
+	sums := md5.New()
+	for i, part := range request.Parts {
+		if i > 0 && part.PartNumber <= request.Parts[i-1].PartNumber {
+			writeError(w, http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order")
+			return
+		}
+		content, ok := u.parts[part.PartNumber]
+		if !ok || strings.Trim(part.ETag, `"`) != strings.Trim(etag(content), `"`) {
+			writeError(w, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("Part %d could not be found", part.PartNumber))
+			return
+		}
+		if i < len(request.Parts)-1 && len(content) < minPartSize {
+			writeError(w, http.StatusBadRequest, "EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size")
+			return
+		}
+		data = append(data, content...)
+		sum := md5.Sum(content)
+		sums.Write(sum[:])
+	}
+
+	obj, err := newObject(u.key, data, u.header)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	obj.ETag = fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sums.Sum(nil)), len(request.Parts))
+	s.put(b, obj)
+	delete(b.uploads, id)
+
+	writeWriteHeaders(w, b, obj)
+	writeXML(w, http.StatusOK, completeMultipartUploadResult{
+		Location: fmt.Sprintf("%s/%s/%s", s.URL, bucketName, u.key),
+		Bucket:   bucketName,
+		Key:      u.key,
+		ETag:     obj.ETag,
+	})
+}
@@ -0,0 +1,556 @@
+package s3test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readBody reads the body of r, decoding aws-chunked encoding of streaming uploads.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	var reader io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") ||
+		strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		reader = &chunkedReader{reader: bufio.NewReader(r.Body)}
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return nil, false
+	}
+	return data, true
+}
+
+// chunkedReader decodes aws-chunked bodies, "<hex size>[;chunk-signature=...]\r\n<data>\r\n" ended by
+// a chunk of size 0 and optional trailers, which are ignored.
+type chunkedReader struct {
+	reader    *bufio.Reader
+	remaining int64
+	done      bool
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.done {
+		return 0, io.EOF
+	}
+	if c.remaining == 0 {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return 0, fmt.Errorf("read chunk size: %w", err)
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid chunk size %q", sizeHex)
+		}
+		if size == 0 {
+			c.done = true
+			_, _ = io.Copy(io.Discard, c.reader)
+			return 0, io.EOF
+		}
+		c.remaining = size
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.reader.Read(p)
+	c.remaining -= int64(n)
+	if c.remaining == 0 && err == nil {
+		// CRLF after data
+		_, err = c.reader.Discard(2)
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// newObject creates an object of key from headers of PutObject, CopyObject and CreateMultipartUpload.
+func newObject(key string, data []byte, header http.Header) (*Object, error) {
+	obj := &Object{
+		Key:          key,
+		Data:         data,
+		ContentType:  header.Get("Content-Type"),
+		Metadata:     make(map[string]string),
+		StorageClass: header.Get("X-Amz-Storage-Class"),
+		ACL:          header.Get("X-Amz-Acl"),
+		ETag:         etag(data),
+		LastModified: time.Now().UTC().Truncate(time.Millisecond),
+
+		ServerSideEncryption: header.Get("X-Amz-Server-Side-Encryption"),
+		KMSKeyID:             header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"),
+		BucketKeyEnabled:     header.Get("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled") == "true",
+		CustomerKeyMD5:       header.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5"),
+	}
+	if obj.ContentType == "" {
+		obj.ContentType = "binary/octet-stream"
+	}
+	if obj.StorageClass == "" {
+		obj.StorageClass = "STANDARD"
+	}
+	if obj.ACL == "" {
+		obj.ACL = "private"
+	}
+	if obj.ServerSideEncryption == "aws:kms" && obj.KMSKeyID == "" {
+		obj.KMSKeyID = "aws/s3"
+	}
+	for name, values := range header {
+		if k, ok := strings.CutPrefix(name, "X-Amz-Meta-"); ok && len(values) > 0 {
+			obj.Metadata[strings.ToLower(k)] = values[0]
+		}
+	}
+	if tagging := header.Get("X-Amz-Tagging"); tagging != "" {
+		tags, err := parseTagging(tagging)
+		if err != nil {
+			return nil, err
+		}
+		obj.Tags = tags
+	}
+	return obj, nil
+}
+
+func parseTagging(tagging string) (map[string]string, error) {
+	values, err := url.ParseQuery(tagging)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(values))
+	for k := range values {
+		tags[k] = values.Get(k)
+	}
+	return tags, nil
+}
+
+// archived reports whether obj must be restored before reading.
+func (o *Object) archived() bool {
+	return o.ArchiveStatus != "" ||
+		(o.StorageClass == "GLACIER" || o.StorageClass == "DEEP_ARCHIVE") && time.Now().After(o.RestoreExpiresAt)
+}
+
+// checkCustomerKey checks keyMD5, the SSE-C key MD5 header of a request reading obj. It writes the error if not matched.
+func checkCustomerKey(w http.ResponseWriter, obj *Object, keyMD5 string) bool {
+	if obj.CustomerKeyMD5 == keyMD5 {
+		return true
+	}
+	if obj.CustomerKeyMD5 == "" {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "The object was not encrypted with a customer provided key")
+	} else {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "The object was encrypted with a different customer provided key")
+	}
+	return false
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	data, ok := readBody(w, r)
+	if !ok {
+		return
+	}
+	obj, err := newObject(key, data, r.Header)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	s.put(b, obj)
+	writeWriteHeaders(w, b, obj)
+}
+
+// writeWriteHeaders writes headers of responses of uploads and copies.
+func writeWriteHeaders(w http.ResponseWriter, b *bucket, obj *Object) {
+	w.Header().Set("ETag", obj.ETag)
+	if b.versioned {
+		w.Header().Set("X-Amz-Version-Id", obj.VersionID)
+	}
+	writeEncryptionHeaders(w, obj)
+}
+
+func writeEncryptionHeaders(w http.ResponseWriter, obj *Object) {
+	if obj.ServerSideEncryption != "" {
+		w.Header().Set("X-Amz-Server-Side-Encryption", obj.ServerSideEncryption)
+	}
+	if obj.KMSKeyID != "" {
+		w.Header().Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", obj.KMSKeyID)
+	}
+	if obj.BucketKeyEnabled {
+		w.Header().Set("X-Amz-Server-Side-Encryption-Bucket-Key-Enabled", "true")
+	}
+	if obj.CustomerKeyMD5 != "" {
+		w.Header().Set("X-Amz-Server-Side-Encryption-Customer-Algorithm", "AES256")
+		w.Header().Set("X-Amz-Server-Side-Encryption-Customer-Key-Md5", obj.CustomerKeyMD5)
+	}
+}
+
+// lookup returns the version of key requested by the versionId parameter, or the latest version.
+// It writes the error and returns nil if not found.
+func (s *Server) lookup(w http.ResponseWriter, b *bucket, key string, versionID string) *Object {
+	if versionID != "" {
+		obj := b.version(key, versionID)
+		if obj == nil {
+			writeError(w, http.StatusNotFound, "NoSuchVersion", "The specified version does not exist")
+			return nil
+		}
+		if obj.DeleteMarker {
+			w.Header().Set("X-Amz-Delete-Marker", "true")
+			writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against a delete marker")
+			return nil
+		}
+		return obj
+	}
+
+	obj := b.latest(key)
+	if obj == nil || obj.DeleteMarker {
+		if obj != nil {
+			w.Header().Set("X-Amz-Delete-Marker", "true")
+		}
+		writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+		return nil
+	}
+	return obj
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	obj := s.lookup(w, b, key, r.URL.Query().Get("versionId"))
+	if obj == nil {
+		return
+	}
+	if !checkCustomerKey(w, obj, r.Header.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5")) {
+		return
+	}
+	if r.Method == http.MethodGet && obj.archived() {
+		writeError(w, http.StatusForbidden, "InvalidObjectState", "The operation is not valid for the object's storage class")
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", obj.ContentType)
+	header.Set("ETag", obj.ETag)
+	header.Set("Last-Modified", obj.LastModified.Format(http.TimeFormat))
+	header.Set("Accept-Ranges", "bytes")
+	if b.versioned {
+		header.Set("X-Amz-Version-Id", obj.VersionID)
+	}
+	if obj.StorageClass != "STANDARD" {
+		header.Set("X-Amz-Storage-Class", obj.StorageClass)
+	}
+	if obj.ArchiveStatus != "" {
+		header.Set("X-Amz-Archive-Status", obj.ArchiveStatus)
+	}
+	if !obj.RestoreExpiresAt.IsZero() {
+		header.Set("X-Amz-Restore", fmt.Sprintf(`ongoing-request="false", expiry-date="%s"`, obj.RestoreExpiresAt.Format(http.TimeFormat)))
+	}
+	if len(obj.Tags) > 0 {
+		header.Set("X-Amz-Tagging-Count", strconv.Itoa(len(obj.Tags)))
+	}
+	for k, v := range obj.Metadata {
+		header.Set("X-Amz-Meta-"+k, v)
+	}
+	writeEncryptionHeaders(w, obj)
+
+	data := obj.Data
+	status := http.StatusOK
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		start, end, ok := parseRange(rangeHeader, int64(len(obj.Data)))
+		if !ok {
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", len(obj.Data)))
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+			return
+		}
+		data = obj.Data[start : end+1]
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(obj.Data)))
+		status = http.StatusPartialContent
+	}
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		_, _ = w.Write(data)
+	}
+}
+
+// parseRange parses a single range, "bytes=0-99", "bytes=100-" or "bytes=-100", returning inclusive offsets.
+func parseRange(header string, size int64) (start, end int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, found := strings.Cut(spec, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	var err error
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		return max(size-n, 0), size - 1, true
+	}
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end = size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end, true
+}
+
+// remove deletes a version of key, or the object if versionID is empty.
+// It returns the version deleted or the delete marker created in versioned buckets.
+func (s *Server) remove(b *bucket, key string, versionID string) (removedVersion string, deleteMarker bool) {
+	if versionID != "" {
+		versions := b.objects[key]
+		for i, obj := range versions {
+			if obj.VersionID == versionID {
+				versions = append(versions[:i:i], versions[i+1:]...)
+				if len(versions) == 0 {
+					delete(b.objects, key)
+				} else {
+					b.objects[key] = versions
+				}
+				return versionID, obj.DeleteMarker
+			}
+		}
+		return versionID, false
+	}
+
+	if b.versioned {
+		marker := &Object{Key: key, DeleteMarker: true, LastModified: time.Now().UTC().Truncate(time.Millisecond)}
+		s.put(b, marker)
+		return marker.VersionID, true
+	}
+	delete(b.objects, key)
+	return "", false
+}
+
+func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	versionID, deleteMarker := s.remove(b, key, r.URL.Query().Get("versionId"))
+	if versionID != "" {
+		w.Header().Set("X-Amz-Version-Id", versionID)
+	}
+	if deleteMarker {
+		w.Header().Set("X-Amz-Delete-Marker", "true")
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	// the query is cut before unescaping, keys may contain escaped "?"
+	source, rawQuery, _ := strings.Cut(r.Header.Get("X-Amz-Copy-Source"), "?")
+	source, err := url.PathUnescape(strings.TrimPrefix(source, "/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	versionID := query.Get("versionId")
+	srcBucketName, srcKey, _ := strings.Cut(source, "/")
+	srcBucket, ok := s.buckets[srcBucketName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	src := s.lookup(w, srcBucket, srcKey, versionID)
+	if src == nil {
+		return
+	}
+	if !checkCustomerKey(w, src, r.Header.Get("X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key-Md5")) {
+		return
+	}
+	if src.archived() {
+		writeError(w, http.StatusForbidden, "InvalidObjectState", "The operation is not valid for the object's storage class")
+		return
+	}
+
+	obj, err := newObject(key, bytes.Clone(src.Data), r.Header)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	if r.Header.Get("X-Amz-Metadata-Directive") != "REPLACE" {
+		obj.ContentType = src.ContentType
+		obj.Metadata = make(map[string]string, len(src.Metadata))
+		for k, v := range src.Metadata {
+			obj.Metadata[k] = v
+		}
+	}
+	if r.Header.Get("X-Amz-Tagging-Directive") != "REPLACE" {
+		obj.Tags = make(map[string]string, len(src.Tags))
+		for k, v := range src.Tags {
+			obj.Tags[k] = v
+		}
+	}
+	s.put(b, obj)
+
+	writeWriteHeaders(w, b, obj)
+	if srcBucket.versioned {
+		w.Header().Set("X-Amz-Copy-Source-Version-Id", src.VersionID)
+	}
+	writeXML(w, http.StatusOK, copyObjectResult{ETag: obj.ETag, LastModified: formatTime(obj.LastModified)})
+}
+
+type restoreRequest struct {
+	Days int `xml:"Days"`
+}
+
+func (s *Server) restoreObject(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	var request restoreRequest
+	if !decodeXML(w, r, &request) {
+		return
+	}
+	obj := s.lookup(w, b, key, r.URL.Query().Get("versionId"))
+	if obj == nil {
+		return
+	}
+	if obj.ArchiveStatus != "" {
+		// restored INTELLIGENT_TIERING objects move back to the frequent access tier without expiration
+		obj.ArchiveStatus = ""
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	if obj.StorageClass != "GLACIER" && obj.StorageClass != "DEEP_ARCHIVE" {
+		writeError(w, http.StatusForbidden, "InvalidObjectState", "Restore is not allowed for the object's storage class")
+		return
+	}
+
+	// restores complete immediately
+	status := http.StatusAccepted
+	if !obj.RestoreExpiresAt.IsZero() {
+		status = http.StatusOK
+	}
+	obj.RestoreExpiresAt = time.Now().UTC().Add(time.Duration(max(request.Days, 1)) * 24 * time.Hour).Truncate(time.Second)
+	w.WriteHeader(status)
+}
+
+type tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Tags    []tag    `xml:"TagSet>Tag"`
+}
+
+type tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+func (s *Server) serveTagging(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	obj := s.lookup(w, b, key, r.URL.Query().Get("versionId"))
+	if obj == nil {
+		return
+	}
+	if b.versioned {
+		w.Header().Set("X-Amz-Version-Id", obj.VersionID)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		result := tagging{Tags: []tag{}}
+		for k, v := range obj.Tags {
+			result.Tags = append(result.Tags, tag{Key: k, Value: v})
+		}
+		writeXML(w, http.StatusOK, result)
+	case http.MethodPut:
+		var request tagging
+		if !decodeXML(w, r, &request) {
+			return
+		}
+		obj.Tags = make(map[string]string, len(request.Tags))
+		for _, t := range request.Tags {
+			obj.Tags[t.Key] = t.Value
+		}
+	case http.MethodDelete:
+		obj.Tags = nil
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "The operation is not supported")
+	}
+}
+
+// allUsers is the grantee URI of public access.
+const allUsers = "http://acs.amazonaws.com/groups/global/AllUsers"
+
+// ownerID is the canonical user ID of the owner of all objects.
+const ownerID = "s3test"
+
+type accessControlPolicy struct {
+	XMLName xml.Name `xml:"AccessControlPolicy"`
+	Owner   owner    `xml:"Owner"`
+	Grants  []grant  `xml:"AccessControlList>Grant"`
+}
+
+type owner struct {
+	ID string `xml:"ID"`
+}
+
+type grant struct {
+	Grantee    grantee `xml:"Grantee"`
+	Permission string  `xml:"Permission"`
+}
+
+type grantee struct {
+	// Type is encoded without declaring the xsi namespace, which the SDK matches by the literal prefix.
+	Type string `xml:"xsi:type,attr"`
+	ID   string `xml:"ID,omitempty"`
+	URI  string `xml:"URI,omitempty"`
+}
+
+// serveACL supports the canned ACLs "private" and "public-read", set by the x-amz-acl header or by grants.
+func (s *Server) serveACL(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	obj := s.lookup(w, b, key, r.URL.Query().Get("versionId"))
+	if obj == nil {
+		return
+	}
+	if b.versioned {
+		w.Header().Set("X-Amz-Version-Id", obj.VersionID)
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		policy := accessControlPolicy{
+			Owner:  owner{ID: ownerID},
+			Grants: []grant{{Grantee: grantee{Type: "CanonicalUser", ID: ownerID}, Permission: "FULL_CONTROL"}},
+		}
+		if obj.ACL == "public-read" {
+			policy.Grants = append(policy.Grants, grant{Grantee: grantee{Type: "Group", URI: allUsers}, Permission: "READ"})
+		}
+		writeXML(w, http.StatusOK, policy)
+	case http.MethodPut:
+		if acl := r.Header.Get("X-Amz-Acl"); acl != "" {
+			obj.ACL = acl
+			return
+		}
+		var policy accessControlPolicy
+		if !decodeXML(w, r, &policy) {
+			return
+		}
+		obj.ACL = "private"
+		for _, g := range policy.Grants {
+			if g.Grantee.URI == allUsers && g.Permission == "READ" {
+				obj.ACL = "public-read"
+			}
+		}
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "The operation is not supported")
+	}
+}
@@ -0,0 +1,387 @@
+// Package s3test provides an in-memory S3 compatible server for tests, so services created by storage.NewS3
+// and presigned URLs can be tested without a bucket.
+//
+//	server := s3test.NewServer("bucket")
+//	defer server.Close()
+//	service, err := storage.NewS3(server.Config(), "bucket", "", storage.S3Options{
+//		Endpoint:     server.URL,
+//		UsePathStyle: true,
+//	})
+//
+// The server addresses buckets by path, so UsePathStyle is required. It verifies SigV4 signatures of the
+// credentials of Config, by headers or presigned URLs including their expiration, but not payload hashes or
+// chunk signatures of streaming uploads. Anonymous requests can only read public-read objects.
+// It supports objects with ranges, copy, batch delete, ListObjectsV2, multipart uploads, tags, versioning,
+// lifecycle configurations, restore, canned ACLs and SSE-C keys.
+package s3test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+// Region is the region of the server.
+const Region = "us-east-1"
+
+// Object is a version of an object stored by the server.
+type Object struct {
+	Key          string
+	VersionID    string
+	Data         []byte
+	ContentType  string
+	Metadata     map[string]string
+	Tags         map[string]string
+	StorageClass string
+	// ACL is the canned ACL, "private" or "public-read".
+	ACL          string
+	ETag         string
+	LastModified time.Time
+	DeleteMarker bool
+	// ServerSideEncryption is "AES256" or "aws:kms", empty if not set.
+	ServerSideEncryption string
+	KMSKeyID             string
+	BucketKeyEnabled     bool
+	// CustomerKeyMD5 is the base64 MD5 of the SSE-C key, required to read the object.
+	CustomerKeyMD5 string
+	// RestoreExpiresAt is set by restore requests.
+	RestoreExpiresAt time.Time
+	// ArchiveStatus is "ARCHIVE_ACCESS" or "DEEP_ARCHIVE_ACCESS" for INTELLIGENT_TIERING objects in archive tiers,
+	// set by Archive and cleared by restore requests.
+	ArchiveStatus string
+}
+
+type bucket struct {
+	versioned bool
+	// versions of keys, oldest first
+	objects   map[string][]*Object
+	uploads   map[string]*upload
+	lifecycle []byte
+}
+
+// Server is an in-memory S3 compatible server.
+type Server struct {
+	// URL is the endpoint of the server, such as "http://127.0.0.1:50000".
+	URL string
+
+	server  *httptest.Server
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	seq     int
+}
+
+// NewServer starts a server with buckets. Buckets can also be created by CreateBucket requests.
+func NewServer(buckets ...string) *Server {
+	s := &Server{buckets: make(map[string]*bucket)}
+	for _, name := range buckets {
+		s.buckets[name] = newBucket()
+	}
+	s.server = httptest.NewServer(s)
+	s.URL = s.server.URL
+	return s
+}
+
+func newBucket() *bucket {
+	return &bucket{
+		objects: make(map[string][]*Object),
+		uploads: make(map[string]*upload),
+	}
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Config returns an aws.Config with static credentials in Region.
+func (s *Server) Config() aws.Config {
+	return aws.Config{
+		Region:      Region,
+		Credentials: credentials.NewStaticCredentialsProvider(accessKeyID, secretAccessKey, ""),
+	}
+}
+
+// EnableVersioning enables versioning of bucket, it's created if not exists.
+func (s *Server) EnableVersioning(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[name]
+	if !ok {
+		b = newBucket()
+		s.buckets[name] = b
+	}
+	b.versioned = true
+}
+
+// Object returns the latest version of key, false if not exists or deleted.
+func (s *Server) Object(bucketName string, key string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return Object{}, false
+	}
+	obj := b.latest(key)
+	if obj == nil || obj.DeleteMarker {
+		return Object{}, false
+	}
+	return *obj, true
+}
+
+// Archive moves the latest version of key to an archive tier of INTELLIGENT_TIERING, "ARCHIVE_ACCESS" or
+// "DEEP_ARCHIVE_ACCESS", as S3 does with objects not accessed for months. It returns false if key doesn't exist
+// or isn't stored in INTELLIGENT_TIERING.
+func (s *Server) Archive(bucketName string, key string, status string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return false
+	}
+	obj := b.latest(key)
+	if obj == nil || obj.DeleteMarker || obj.StorageClass != "INTELLIGENT_TIERING" {
+		return false
+	}
+	obj.ArchiveStatus = status
+	return true
+}
+
+// Keys returns sorted keys of objects in bucket, excluding deleted ones.
+func (s *Server) Keys(bucketName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return nil
+	}
+	return b.keys("")
+}
+
+// Uploads returns the number of multipart uploads of bucket in progress.
+func (s *Server) Uploads(bucketName string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b, ok := s.buckets[bucketName]; ok {
+		return len(b.uploads)
+	}
+	return 0
+}
+
+func (b *bucket) latest(key string) *Object {
+	versions := b.objects[key]
+	if len(versions) == 0 {
+		return nil
+	}
+	return versions[len(versions)-1]
+}
+
+func (b *bucket) version(key string, versionID string) *Object {
+	for _, obj := range b.objects[key] {
+		if obj.VersionID == versionID {
+			return obj
+		}
+	}
+	return nil
+}
+
+// keys returns sorted keys with prefix whose latest version is not a delete marker.
+func (b *bucket) keys(prefix string) []string {
+	var keys []string
+	for key := range b.objects {
+		obj := b.latest(key)
+		if strings.HasPrefix(key, prefix) && obj != nil && !obj.DeleteMarker {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// put stores obj as the latest version of its key.
+func (s *Server) put(b *bucket, obj *Object) {
+	if b.versioned {
+		obj.VersionID = s.nextVersionID()
+		b.objects[obj.Key] = append(b.objects[obj.Key], obj)
+		return
+	}
+	obj.VersionID = "null"
+	b.objects[obj.Key] = []*Object{obj}
+}
+
+func (s *Server) nextVersionID() string {
+	s.seq++
+	return fmt.Sprintf("v%08d", s.seq)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucketName == "" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "listing buckets is not supported")
+		return
+	}
+
+	signed, ok := authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !signed && !s.public(r, bucketName, key) {
+		writeError(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+		return
+	}
+
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		if key == "" && r.Method == http.MethodPut && len(r.URL.Query()) == 0 {
+			s.buckets[bucketName] = newBucket()
+			w.Header().Set("Location", "/"+bucketName)
+			return
+		}
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+
+	if key == "" {
+		s.serveBucket(w, r, bucketName, b)
+		return
+	}
+	s.serveObject(w, r, bucketName, b, key)
+}
+
+// public reports whether r is an anonymous read of a public-read object.
+func (s *Server) public(r *http.Request, bucketName string, key string) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead || len(r.URL.Query()) > 0 {
+		return false
+	}
+	b, ok := s.buckets[bucketName]
+	if !ok {
+		return false
+	}
+	obj := b.latest(key)
+	return obj != nil && !obj.DeleteMarker && obj.ACL == "public-read"
+}
+
+func (s *Server) serveBucket(w http.ResponseWriter, r *http.Request, name string, b *bucket) {
+	query := r.URL.Query()
+	switch {
+	case r.Method == http.MethodGet && query.Has("versions"):
+		s.listVersions(w, r, name, b)
+	case r.Method == http.MethodGet && query.Has("lifecycle"):
+		if b.lifecycle == nil {
+			writeError(w, http.StatusNotFound, "NoSuchLifecycleConfiguration", "The lifecycle configuration does not exist")
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = w.Write(b.lifecycle)
+	case r.Method == http.MethodPut && query.Has("lifecycle"):
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		b.lifecycle = body
+	case r.Method == http.MethodDelete && query.Has("lifecycle"):
+		b.lifecycle = nil
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && query.Has("versioning"):
+		status := ""
+		if b.versioned {
+			status = "Enabled"
+		}
+		writeXML(w, http.StatusOK, versioningConfiguration{Status: status})
+	case r.Method == http.MethodPut && query.Has("versioning"):
+		var config versioningConfiguration
+		if !decodeXML(w, r, &config) {
+			return
+		}
+		b.versioned = config.Status == "Enabled"
+	case r.Method == http.MethodPost && query.Has("delete"):
+		s.deleteObjects(w, r, b)
+	case r.Method == http.MethodGet:
+		s.listObjectsV2(w, r, name, b)
+	case r.Method == http.MethodHead:
+	case r.Method == http.MethodPut:
+		// bucket exists
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "The operation is not supported")
+	}
+}
+
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request, bucketName string, b *bucket, key string) {
+	query := r.URL.Query()
+	switch {
+	case query.Has("uploadId") || query.Has("uploads"):
+		s.serveMultipart(w, r, bucketName, b, key)
+	case query.Has("tagging"):
+		s.serveTagging(w, r, b, key)
+	case query.Has("acl"):
+		s.serveACL(w, r, b, key)
+	case r.Method == http.MethodPost && query.Has("restore"):
+		s.restoreObject(w, r, b, key)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.copyObject(w, r, b, key)
+	case r.Method == http.MethodPut:
+		s.putObject(w, r, b, key)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.getObject(w, r, b, key)
+	case r.Method == http.MethodDelete:
+		s.deleteObject(w, r, b, key)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "The operation is not supported")
+	}
+}
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+}
+
+// writeError writes an S3 error, HEAD responses have no body and are reported by status.
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	writeXML(w, status, errorResponse{Code: code, Message: message})
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(data)
+}
+
+func decodeXML(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := xml.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return false
+	}
+	return true
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// timeFormat is the format of timestamps in XML responses.
+const timeFormat = "2006-01-02T15:04:05.000Z"
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
@@ -0,0 +1,236 @@
+package s3test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/require"
+)
+
+func newClient(t *testing.T) (*s3.Client, *Server) {
+	server := NewServer("bucket")
+	t.Cleanup(server.Close)
+
+	client := s3.NewFromConfig(server.Config(), func(o *s3.Options) {
+		o.EndpointResolver = s3.EndpointResolverFromURL(server.URL)
+		o.UsePathStyle = true
+	})
+	return client, server
+}
+
+func TestServer_list(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newClient(t)
+	ctx := context.Background()
+	for _, key := range []string{"a/1", "a/2", "b/1", "c", "d/e/1"} {
+		_, err := client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader([]byte(key)),
+		})
+		require.NoError(t, err)
+	}
+
+	var keys []string
+	p := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket:  aws.String("bucket"),
+		MaxKeys: 2,
+	})
+	pages := 0
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		require.NoError(t, err)
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+		pages++
+	}
+	require.Equal(t, []string{"a/1", "a/2", "b/1", "c", "d/e/1"}, keys)
+	require.Equal(t, 3, pages)
+
+	out, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:    aws.String("bucket"),
+		Delimiter: aws.String("/"),
+	})
+	require.NoError(t, err)
+	require.Len(t, out.Contents, 1)
+	require.Equal(t, "c", aws.ToString(out.Contents[0].Key))
+	var prefixes []string
+	for _, prefix := range out.CommonPrefixes {
+		prefixes = append(prefixes, aws.ToString(prefix.Prefix))
+	}
+	require.Equal(t, []string{"a/", "b/", "d/"}, prefixes)
+}
+
+func TestServer_range(t *testing.T) {
+	t.Parallel()
+
+	client, _ := newClient(t)
+	ctx := context.Background()
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("digits"),
+		Body:   bytes.NewReader([]byte("0123456789")),
+	})
+	require.NoError(t, err)
+
+	for rangeHeader, want := range map[string]string{
+		"bytes=2-4":  "234",
+		"bytes=7-":   "789",
+		"bytes=-2":   "89",
+		"bytes=8-20": "89",
+	} {
+		out, err := client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("digits"),
+			Range:  aws.String(rangeHeader),
+		})
+		require.NoError(t, err)
+		data, err := io.ReadAll(out.Body)
+		require.NoError(t, err)
+		require.Equal(t, want, string(data), rangeHeader)
+	}
+
+	_, err = client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("digits"),
+		Range:  aws.String("bytes=10-"),
+	})
+	require.Error(t, err)
+}
+
+func TestServer_multipart(t *testing.T) {
+	t.Parallel()
+
+	client, server := newClient(t)
+	ctx := context.Background()
+	created, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String("bucket"),
+		Key:         aws.String("parts"),
+		ContentType: aws.String("text/plain"),
+	})
+	require.NoError(t, err)
+
+	var parts []types.CompletedPart
+	for i, content := range []string{"small", "last"} {
+		out, err := client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String("bucket"),
+			Key:        aws.String("parts"),
+			UploadId:   created.UploadId,
+			PartNumber: int32(i + 1),
+			Body:       bytes.NewReader([]byte(content)),
+		})
+		require.NoError(t, err)
+		parts = append(parts, types.CompletedPart{ETag: out.ETag, PartNumber: int32(i + 1)})
+	}
+
+	// parts except the last one must have at least 5MB
+	_, err = client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String("bucket"),
+		Key:             aws.String("parts"),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+	})
+	require.Error(t, err)
+
+	// parts don't have to start from 1
+	_, err = client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String("bucket"),
+		Key:             aws.String("parts"),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: parts[1:]},
+	})
+	require.NoError(t, err)
+	obj, ok := server.Object("bucket", "parts")
+	require.True(t, ok)
+	require.Equal(t, "last", string(obj.Data))
+	require.Equal(t, "text/plain", obj.ContentType)
+
+	created, err = client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("aborted"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, server.Uploads("bucket"))
+	_, err = client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("aborted"),
+		UploadId: created.UploadId,
+	})
+	require.NoError(t, err)
+	require.Zero(t, server.Uploads("bucket"))
+}
+
+func TestServer_auth(t *testing.T) {
+	t.Parallel()
+
+	client, server := newClient(t)
+	ctx := context.Background()
+	for key, acl := range map[string]types.ObjectCannedACL{"private": "", "public": types.ObjectCannedACLPublicRead} {
+		_, err := client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String(key),
+			ACL:    acl,
+			Body:   bytes.NewReader([]byte(key)),
+		})
+		require.NoError(t, err)
+	}
+
+	// signatures by other secrets are rejected
+	cfg := server.Config()
+	cfg.Credentials = credentials.NewStaticCredentialsProvider(accessKeyID, "wrong", "")
+	wrong := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.EndpointResolver = s3.EndpointResolverFromURL(server.URL)
+		o.UsePathStyle = true
+	})
+	_, err := wrong.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("private")})
+	var ae smithy.APIError
+	require.ErrorAs(t, err, &ae)
+	require.Equal(t, "SignatureDoesNotMatch", ae.ErrorCode())
+
+	// anonymous requests can only read public-read objects
+	require.Equal(t, http.StatusForbidden, getStatus(t, server.URL+"/bucket/private"))
+	require.Equal(t, http.StatusOK, getStatus(t, server.URL+"/bucket/public"))
+
+	presign := func(key string, signingTime time.Time) string {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/bucket/"+key+"?X-Amz-Expires=60", nil)
+		require.NoError(t, err)
+		creds, err := cfg.Credentials.Retrieve(ctx)
+		require.NoError(t, err)
+		creds.SecretAccessKey = secretAccessKey
+		signed, _, err := v4.NewSigner().PresignHTTP(ctx, creds, req, "UNSIGNED-PAYLOAD", "s3", Region, signingTime)
+		require.NoError(t, err)
+		return signed
+	}
+	require.Equal(t, http.StatusOK, getStatus(t, presign("private", time.Now())))
+	require.Equal(t, http.StatusForbidden, getStatus(t, presign("private", time.Now().Add(-time.Hour))))
+	// tampered URLs don't match the signature
+	tampered := strings.Replace(presign("private", time.Now()), "/private?", "/public?", 1)
+	require.Equal(t, http.StatusForbidden, getStatus(t, tampered))
+	u, err := url.Parse(presign("private", time.Now()))
+	require.NoError(t, err)
+	query := u.Query()
+	query.Del("X-Amz-Expires")
+	u.RawQuery = query.Encode()
+	require.Equal(t, http.StatusBadRequest, getStatus(t, u.String()))
+}
+
+func getStatus(t *testing.T, rawURL string) int {
+	resp, err := http.Get(rawURL)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp.StatusCode
+}
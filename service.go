@@ -21,3 +21,73 @@ type Service interface {
 	// method must be one of "GET", "PUT", "HEAD", "DELETE".
 	SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error)
 }
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+	// Metadata is the custom metadata set by WithMetadata on upload.
+	Metadata map[string]string
+	// ExpiresAt is the expiration set by WithTTL, zero if the object doesn't expire.
+	ExpiresAt time.Time
+}
+
+// Stater is implemented by services able to return information of an object.
+// All builtin services implement it.
+type Stater interface {
+	// Stat returns information of the object. The error matches fs.ErrNotExist if the object does not exist.
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+}
+
+// Stat returns information of the object if service implements Stater, otherwise ErrNotSupported.
+func Stat(ctx context.Context, service Service, key string) (ObjectInfo, error) {
+	if s, ok := service.(Stater); ok {
+		return s.Stat(ctx, key)
+	}
+	return ObjectInfo{}, ErrNotSupported
+}
+
+// Lister is implemented by services able to list objects. All builtin services implement it.
+type Lister interface {
+	// List calls fn for each object whose key starts with prefix.
+	// Only Key, Size and LastModified are guaranteed to be set. Listing stops if fn returns an error,
+	// which is returned by List.
+	List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error
+}
+
+// List lists objects if service implements Lister, otherwise returns ErrNotSupported.
+func List(ctx context.Context, service Service, prefix string, fn func(obj ObjectInfo) error) error {
+	if l, ok := service.(Lister); ok {
+		return l.List(ctx, prefix, fn)
+	}
+	return ErrNotSupported
+}
+
+// WithContentType sets content type for upload and copy instead of detecting it from content and extension.
+func WithContentType(ctx context.Context, contentType string) context.Context {
+	return context.WithValue(ctx, CtxS3ContentType, contentType)
+}
+
+const ctxMetadata contextKey = "metadata"
+
+// WithMetadata sets custom metadata for upload and copy. Keys should be lowercase,
+// S3 stores them as "x-amz-meta-*" headers. Metadata set by multiple calls are merged.
+func WithMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	merged := make(map[string]string)
+	for k, v := range metadataFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, ctxMetadata, merged)
+}
+
+func metadataFromContext(ctx context.Context) map[string]string {
+	if v, ok := ctx.Value(ctxMetadata).(map[string]string); ok {
+		return v
+	}
+	return nil
+}
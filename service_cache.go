@@ -0,0 +1,327 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheOptions configures the service created by NewCacheService.
+type CacheOptions struct {
+	// MaxBytes bounds the total size of cached files. Least recently used files are evicted first.
+	// Default is 256MB.
+	MaxBytes int64
+	// Metrics records hits and misses of Download and Exist as backend "cache". Default is NewExpvarMetrics("storage").
+	Metrics Metrics
+}
+
+var _ Service = (*cacheService)(nil)
+
+type cacheEntry struct {
+	key  string
+	size int64
+}
+
+type cacheService struct {
+	remote  Service
+	cache   Service
+	metrics Metrics
+
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      *list.List
+	entries  map[string]*list.Element
+	// fills are downloads from remote in progress, concurrent misses of a key wait for the same fill
+	fills map[string]*cacheFill
+}
+
+type cacheFill struct {
+	done chan struct{}
+	err  error
+}
+
+// NewCacheService wraps remote with a read-through cache stored in cache, such as a disk or memory service.
+//
+// Download reads from cache if the file was cached, otherwise downloads from remote and stores it in cache.
+// Upload writes through the cache to remote. Delete, DeleteBatch, DeletePrefixed and Copy invalidate cached files.
+// Files in cache are only tracked by this service, cache should not be shared with other services.
+// If cache implements Lister, files cached before are tracked again at creation, most recently modified first.
+func NewCacheService(remote Service, cache Service, options ...CacheOptions) Service {
+	opts := CacheOptions{
+		MaxBytes: 256 << 20,
+	}
+	for _, opt := range options {
+		if opt.MaxBytes > 0 {
+			opts.MaxBytes = opt.MaxBytes
+		}
+		if opt.Metrics != nil {
+			opts.Metrics = opt.Metrics
+		}
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = NewExpvarMetrics("storage")
+	}
+
+	s := &cacheService{
+		remote:   remote,
+		cache:    cache,
+		metrics:  opts.Metrics,
+		maxBytes: opts.MaxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		fills:    make(map[string]*cacheFill),
+	}
+	s.load(context.Background())
+	return s
+}
+
+// load tracks files already in cache, such as files cached by a previous process, evicting files exceeding MaxBytes.
+func (s *cacheService) load(ctx context.Context) {
+	var cached []ObjectInfo
+	err := List(ctx, s.cache, "", func(obj ObjectInfo) error {
+		cached = append(cached, obj)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	sort.Slice(cached, func(i, j int) bool {
+		return cached[i].LastModified.Before(cached[j].LastModified)
+	})
+	for _, obj := range cached {
+		s.add(ctx, obj.Key, obj.Size)
+	}
+}
+
+// Upload writes the file to cache first, then uploads the cached copy to remote.
+func (s *cacheService) Upload(ctx context.Context, key string, reader io.Reader) error {
+	s.invalidate(key)
+
+	counter, reader := newCountingReader(reader)
+	err := s.cache.Upload(ctx, key, reader)
+	if err != nil {
+		return err
+	}
+
+	cached, err := s.cache.Download(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer cached.Close()
+
+	err = s.remote.Upload(ctx, key, cached)
+	if err != nil {
+		_ = s.cache.Delete(ctx, key)
+		return err
+	}
+
+	s.add(ctx, key, counter.n)
+	return nil
+}
+
+func (s *cacheService) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	start := time.Now()
+	if s.touch(key) {
+		reader, err := s.cache.Download(ctx, key)
+		if err == nil {
+			s.record("download", start, OutcomeHit)
+			return reader, nil
+		}
+		// fallback to remote if the cached file is gone
+		s.invalidate(key)
+	}
+	s.record("download", start, OutcomeMiss)
+
+	s.mu.Lock()
+	fill, filling := s.fills[key]
+	if !filling {
+		fill = &cacheFill{done: make(chan struct{})}
+		s.fills[key] = fill
+	}
+	s.mu.Unlock()
+
+	if filling {
+		select {
+		case <-fill.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if fill.err != nil {
+			return nil, fill.err
+		}
+		reader, err := s.cache.Download(ctx, key)
+		if err == nil {
+			return reader, nil
+		}
+		// evicted or invalidated since filled
+		return s.remote.Download(ctx, key)
+	}
+
+	reader, err := s.fill(ctx, key)
+	s.mu.Lock()
+	delete(s.fills, key)
+	s.mu.Unlock()
+	fill.err = err
+	close(fill.done)
+	return reader, err
+}
+
+// fill downloads key from remote into cache and opens the cached file.
+func (s *cacheService) fill(ctx context.Context, key string) (io.ReadCloser, error) {
+	remote, err := s.remote.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer remote.Close()
+
+	counter, reader := newCountingReader(remote)
+	err = s.cache.Upload(ctx, key, reader)
+	if err != nil {
+		_ = s.cache.Delete(ctx, key)
+		return nil, err
+	}
+
+	// open before adding, so the file is readable even if it is evicted immediately
+	cached, err := s.cache.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	s.add(ctx, key, counter.n)
+	return cached, nil
+}
+
+func (s *cacheService) Copy(ctx context.Context, src string, dst string) error {
+	s.invalidate(dst)
+	_ = s.cache.Delete(ctx, dst)
+	return s.remote.Copy(ctx, src, dst)
+}
+
+func (s *cacheService) Delete(ctx context.Context, key string) error {
+	s.invalidate(key)
+	err := s.cache.Delete(ctx, key)
+	if err != nil {
+		return err
+	}
+	return s.remote.Delete(ctx, key)
+}
+
+func (s *cacheService) DeleteBatch(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		s.invalidate(key)
+	}
+	err := s.cache.DeleteBatch(ctx, keys)
+	if err != nil {
+		return err
+	}
+	return s.remote.DeleteBatch(ctx, keys)
+}
+
+func (s *cacheService) DeletePrefixed(ctx context.Context, prefix string) error {
+	s.mu.Lock()
+	for key, e := range s.entries {
+		if strings.HasPrefix(key, prefix) {
+			s.remove(e)
+		}
+	}
+	s.mu.Unlock()
+
+	err := s.cache.DeletePrefixed(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	return s.remote.DeletePrefixed(ctx, prefix)
+}
+
+func (s *cacheService) Exist(ctx context.Context, key string) (bool, error) {
+	start := time.Now()
+	if s.touch(key) {
+		s.record("exist", start, OutcomeHit)
+		return true, nil
+	}
+	s.record("exist", start, OutcomeMiss)
+
+	return s.remote.Exist(ctx, key)
+}
+
+func (s *cacheService) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	return Stat(ctx, s.remote, key)
+}
+
+func (s *cacheService) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	return List(ctx, s.remote, prefix, fn)
+}
+
+func (s *cacheService) URL(key string) string {
+	return s.remote.URL(key)
+}
+
+func (s *cacheService) SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error) {
+	return s.remote.SignURL(ctx, key, method, expiresIn)
+}
+
+func (s *cacheService) record(op string, start time.Time, outcome string) {
+	s.metrics.Record(OperationMetric{
+		Operation: op,
+		Backend:   "cache",
+		Duration:  time.Since(start),
+		Outcome:   outcome,
+	})
+}
+
+// touch marks key as recently used and reports whether it is cached.
+func (s *cacheService) touch(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if ok {
+		s.lru.MoveToFront(e)
+	}
+	return ok
+}
+
+// add tracks a cached file and evicts least recently used files exceeding MaxBytes.
+func (s *cacheService) add(ctx context.Context, key string, size int64) {
+	s.mu.Lock()
+	if e, ok := s.entries[key]; ok {
+		s.remove(e)
+	}
+	s.entries[key] = s.lru.PushFront(&cacheEntry{key: key, size: size})
+	s.size += size
+
+	var evicted []string
+	for s.size > s.maxBytes && s.lru.Len() > 0 {
+		e := s.lru.Back()
+		evicted = append(evicted, e.Value.(*cacheEntry).key)
+		s.remove(e)
+	}
+	s.mu.Unlock()
+
+	if len(evicted) > 0 {
+		_ = s.cache.DeleteBatch(context.WithoutCancel(ctx), evicted)
+	}
+}
+
+func (s *cacheService) invalidate(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok {
+		s.remove(e)
+	}
+}
+
+// remove must be called with mu held.
+func (s *cacheService) remove(e *list.Element) {
+	entry := e.Value.(*cacheEntry)
+	s.lru.Remove(e)
+	delete(s.entries, entry.key)
+	s.size -= entry.size
+}
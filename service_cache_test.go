@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheService(t *testing.T) {
+	t.Parallel()
+
+	remote, err := NewMemoryService("http://localhost/remote")
+	require.NoError(t, err)
+	cache, err := NewMemoryService("http://localhost/cache")
+	require.NoError(t, err)
+
+	var outcomes []string
+	service := NewCacheService(remote, cache, CacheOptions{
+		MaxBytes: 15,
+		Metrics: MetricsFunc(func(metric OperationMetric) {
+			outcomes = append(outcomes, metric.Operation+" "+metric.Outcome)
+		}),
+	})
+
+	require.NoError(t, remote.Upload(context.TODO(), "a.txt", strings.NewReader("aaaaaaaaaa")))
+
+	download := func(key string) string {
+		reader, err := service.Download(context.TODO(), key)
+		require.NoError(t, err)
+		defer reader.Close()
+		b, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	require.Equal(t, "aaaaaaaaaa", download("a.txt"))
+	// served from cache even if remote changed behind the cache
+	require.NoError(t, remote.Delete(context.TODO(), "a.txt"))
+	require.Equal(t, "aaaaaaaaaa", download("a.txt"))
+	exist, err := service.Exist(context.TODO(), "a.txt")
+	require.NoError(t, err)
+	require.True(t, exist)
+	require.Equal(t, []string{"download miss", "download hit", "exist hit"}, outcomes)
+
+	// write through and evict the least recently used file
+	require.NoError(t, service.Upload(context.TODO(), "b.txt", strings.NewReader("bbbbbbbbbb")))
+	exist, err = remote.Exist(context.TODO(), "b.txt")
+	require.NoError(t, err)
+	require.True(t, exist)
+	exist, err = cache.Exist(context.TODO(), "a.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+	exist, err = cache.Exist(context.TODO(), "b.txt")
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	// invalidate on delete
+	require.NoError(t, service.DeletePrefixed(context.TODO(), "b"))
+	exist, err = service.Exist(context.TODO(), "b.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+	exist, err = cache.Exist(context.TODO(), "b.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+}
+
+type countingDownloads struct {
+	Service
+	downloads atomic.Int32
+}
+
+func (s *countingDownloads) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.downloads.Add(1)
+	time.Sleep(10 * time.Millisecond)
+	return s.Service.Download(ctx, key)
+}
+
+func TestCacheService_concurrentMisses(t *testing.T) {
+	t.Parallel()
+
+	memory, err := NewMemoryService("http://localhost/remote")
+	require.NoError(t, err)
+	require.NoError(t, memory.Upload(context.TODO(), "a.txt", strings.NewReader("aaaaaaaaaa")))
+	remote := &countingDownloads{Service: memory}
+	cache, err := NewDiskService(t.TempDir(), "http://localhost/cache")
+	require.NoError(t, err)
+	service := NewCacheService(remote, cache, CacheOptions{Metrics: MetricsFunc(func(OperationMetric) {})})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reader, err := service.Download(context.TODO(), "a.txt")
+			require.NoError(t, err)
+			defer reader.Close()
+			b, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			require.Equal(t, "aaaaaaaaaa", string(b))
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), remote.downloads.Load())
+}
+
+func TestCacheService_restart(t *testing.T) {
+	t.Parallel()
+
+	remote, err := NewMemoryService("http://localhost/remote")
+	require.NoError(t, err)
+	dir := t.TempDir()
+	cache, err := NewDiskService(dir, "http://localhost/cache")
+	require.NoError(t, err)
+	noMetrics := CacheOptions{MaxBytes: 15, Metrics: MetricsFunc(func(OperationMetric) {})}
+
+	service := NewCacheService(remote, cache, noMetrics)
+	require.NoError(t, service.Upload(context.TODO(), "a.txt", strings.NewReader("aaaaaaaaaa")))
+
+	// files cached before are tracked and evicted
+	var outcomes []string
+	service = NewCacheService(remote, cache, CacheOptions{
+		MaxBytes: 15,
+		Metrics: MetricsFunc(func(metric OperationMetric) {
+			outcomes = append(outcomes, metric.Operation+" "+metric.Outcome)
+		}),
+	})
+	exist, err := service.Exist(context.TODO(), "a.txt")
+	require.NoError(t, err)
+	require.True(t, exist)
+	require.Equal(t, []string{"exist hit"}, outcomes)
+
+	require.NoError(t, service.Upload(context.TODO(), "b.txt", strings.NewReader("bbbbbbbbbb")))
+	exist, err = cache.Exist(context.TODO(), "a.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+}
@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// MetadataContentEncoding records the compression of objects uploaded by the service created by NewCompressedService.
+	MetadataContentEncoding = "content-encoding"
+	// MetadataUncompressedSize records the size of compressed objects before compression.
+	MetadataUncompressedSize = "uncompressed-size"
+
+	EncodingGzip = "gzip"
+	EncodingZstd = "zstd"
+)
+
+// CompressibleContentTypes are content types worth compressing. Types ending with "/" match by prefix.
+var CompressibleContentTypes = []string{
+	"text/",
+	"application/json",
+	"application/xml",
+	"application/javascript",
+	"application/x-ndjson",
+	"application/csv",
+	"image/svg+xml",
+}
+
+// CompressionOptions configures the service created by NewCompressedService.
+type CompressionOptions struct {
+	// Encoding is EncodingGzip or EncodingZstd. Default is EncodingGzip.
+	Encoding string
+	// ContentTypes limits compression to files of these content types, such as CompressibleContentTypes.
+	// Types ending with "/" match by prefix. Default is compressing all files.
+	ContentTypes []string
+}
+
+var _ Service = (*compressedService)(nil)
+
+type compressedService struct {
+	service      Service
+	encoding     string
+	contentTypes []string
+}
+
+// NewCompressedService wraps service to compress files on upload and decompress them on download.
+//
+// The encoding is recorded in metadata, so compressed and uncompressed files can coexist
+// and service must implement Stater. Stat returns the uncompressed size, List returns the stored size,
+// and URL serves compressed content.
+func NewCompressedService(service Service, options ...CompressionOptions) (Service, error) {
+	s := &compressedService{
+		service:  service,
+		encoding: EncodingGzip,
+	}
+	for _, opt := range options {
+		if opt.Encoding != "" {
+			s.encoding = opt.Encoding
+		}
+		if opt.ContentTypes != nil {
+			s.contentTypes = opt.ContentTypes
+		}
+	}
+
+	switch s.encoding {
+	case EncodingGzip, EncodingZstd:
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", s.encoding)
+	}
+
+	return s, nil
+}
+
+func (s *compressedService) Upload(ctx context.Context, key string, reader io.Reader) error {
+	// the content type is detected from uncompressed content, the service would sniff compressed bytes
+	contentType, reader, err := detectUploadContentType(ctx, key, reader)
+	if err != nil {
+		return err
+	}
+	ctx = WithContentType(ctx, contentType)
+
+	if !s.compressible(ctx, key) {
+		return s.service.Upload(ctx, key, reader)
+	}
+
+	// the size is read before compressing starts reading reader
+	metadata := map[string]string{MetadataContentEncoding: s.encoding}
+	if size, ok := readerSize(reader); ok {
+		metadata[MetadataUncompressedSize] = strconv.FormatInt(size, 10)
+	}
+	ctx = WithMetadata(ctx, metadata)
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(compress(s.encoding, pw, reader))
+	}()
+	defer pr.Close()
+
+	return s.service.Upload(ctx, key, pr)
+}
+
+func (s *compressedService) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	info, err := Stat(ctx, s.service, key)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := s.service.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch encoding := info.Metadata[MetadataContentEncoding]; encoding {
+	case "":
+		return reader, nil
+	case EncodingGzip:
+		gr, err := gzip.NewReader(reader)
+		if err != nil {
+			reader.Close()
+			return nil, err
+		}
+		return &decompressReader{Reader: gr, closers: []io.Closer{gr, reader}}, nil
+	case EncodingZstd:
+		zr, err := zstd.NewReader(reader)
+		if err != nil {
+			reader.Close()
+			return nil, err
+		}
+		return &decompressReader{Reader: zr, closers: []io.Closer{zr.IOReadCloser(), reader}}, nil
+	default:
+		reader.Close()
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+func (s *compressedService) Copy(ctx context.Context, src string, dst string) error {
+	return s.service.Copy(ctx, src, dst)
+}
+
+func (s *compressedService) Delete(ctx context.Context, key string) error {
+	return s.service.Delete(ctx, key)
+}
+
+func (s *compressedService) DeleteBatch(ctx context.Context, keys []string) error {
+	return s.service.DeleteBatch(ctx, keys)
+}
+
+func (s *compressedService) DeletePrefixed(ctx context.Context, prefix string) error {
+	return s.service.DeletePrefixed(ctx, prefix)
+}
+
+func (s *compressedService) Exist(ctx context.Context, key string) (bool, error) {
+	return s.service.Exist(ctx, key)
+}
+
+// Stat returns the uncompressed size of compressed objects. The size is recorded on upload of readers with
+// known size, such as bytes.Reader and files, otherwise it's counted by decompressing the object.
+func (s *compressedService) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := Stat(ctx, s.service, key)
+	if err != nil || info.Metadata[MetadataContentEncoding] == "" {
+		return info, err
+	}
+
+	if size, err := strconv.ParseInt(info.Metadata[MetadataUncompressedSize], 10, 64); err == nil {
+		info.Size = size
+		return info, nil
+	}
+
+	reader, err := s.Download(ctx, key)
+	if err != nil {
+		return info, err
+	}
+	defer reader.Close()
+	info.Size, err = io.Copy(io.Discard, reader)
+	return info, err
+}
+
+func (s *compressedService) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	return List(ctx, s.service, prefix, fn)
+}
+
+func (s *compressedService) URL(key string) string {
+	return s.service.URL(key)
+}
+
+func (s *compressedService) SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error) {
+	return s.service.SignURL(ctx, key, method, expiresIn)
+}
+
+func (s *compressedService) compressible(ctx context.Context, key string) bool {
+	if len(s.contentTypes) == 0 {
+		return true
+	}
+
+	contentType := contentTypeFromContext(ctx)
+	if contentType == "" {
+		contentType = MimeTypeByExtension(path.Ext(key))
+	}
+	// strip parameters such as "; charset=utf-8"
+	contentType, _, _ = strings.Cut(contentType, ";")
+	if contentType == "" {
+		return false
+	}
+
+	for _, t := range s.contentTypes {
+		if strings.HasSuffix(t, "/") && strings.HasPrefix(contentType, t) || contentType == t {
+			return true
+		}
+	}
+	return false
+}
+
+func compress(encoding string, w io.Writer, r io.Reader) error {
+	var cw io.WriteCloser
+	switch encoding {
+	case EncodingZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		cw = zw
+	default:
+		cw = gzip.NewWriter(w)
+	}
+
+	_, err := io.Copy(cw, r)
+	if err != nil {
+		cw.Close()
+		return err
+	}
+	return cw.Close()
+}
+
+type decompressReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *decompressReader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressedService(t *testing.T) {
+	t.Parallel()
+
+	content := strings.Repeat(`{"hello":"world"}`, 1000)
+
+	for _, encoding := range []string{EncodingGzip, EncodingZstd} {
+		encoding := encoding
+		t.Run(encoding, func(t *testing.T) {
+			t.Parallel()
+
+			backend, err := NewMemoryService("http://localhost/memory")
+			require.NoError(t, err)
+			service, err := NewCompressedService(backend, CompressionOptions{
+				Encoding:     encoding,
+				ContentTypes: CompressibleContentTypes,
+			})
+			require.NoError(t, err)
+
+			require.NoError(t, service.Upload(context.TODO(), "data.json", strings.NewReader(content)))
+			require.NoError(t, service.Upload(context.TODO(), "image.png", strings.NewReader(content)))
+			// uploaded without the wrapper
+			require.NoError(t, backend.Upload(context.TODO(), "plain.json", strings.NewReader(content)))
+
+			info, err := Stat(context.TODO(), backend, "data.json")
+			require.NoError(t, err)
+			require.Equal(t, encoding, info.Metadata[MetadataContentEncoding])
+			require.Less(t, info.Size, int64(len(content)/10))
+			// the content type is of uncompressed content
+			require.Equal(t, "application/json", info.ContentType)
+
+			info, err = Stat(context.TODO(), service, "data.json")
+			require.NoError(t, err)
+			require.Equal(t, int64(len(content)), info.Size)
+
+			// the size of streams is unknown on upload
+			require.NoError(t, service.Upload(context.TODO(), "stream.json", io.MultiReader(strings.NewReader(content))))
+			info, err = Stat(context.TODO(), service, "stream.json")
+			require.NoError(t, err)
+			require.Equal(t, int64(len(content)), info.Size)
+			require.Equal(t, "application/json", info.ContentType)
+
+			info, err = Stat(context.TODO(), backend, "image.png")
+			require.NoError(t, err)
+			require.Empty(t, info.Metadata[MetadataContentEncoding])
+
+			for _, key := range []string{"data.json", "image.png", "plain.json"} {
+				reader, err := service.Download(context.TODO(), key)
+				require.NoError(t, err)
+				b, err := io.ReadAll(reader)
+				require.NoError(t, err)
+				require.NoError(t, reader.Close())
+				require.Equal(t, content, string(b), key)
+			}
+		})
+	}
+
+	_, err := NewCompressedService(NewNullService(), CompressionOptions{Encoding: "br"})
+	require.Error(t, err)
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -9,13 +10,52 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 	"time"
 
 	pkgerr "github.com/pkg/errors"
 )
 
 var _ Service = (*disk)(nil)
+var _ Expirer = (*disk)(nil)
+var _ Tagger = (*disk)(nil)
+
+// diskMetadataDir is the directory under dir storing sidecar files of objects with metadata.
+const diskMetadataDir = ".metadata"
+
+// diskTempDir is the directory under dir storing files being written, which are renamed into place when complete.
+const diskTempDir = ".tmp"
+
+// diskSidecar is stored as JSON in a sidecar file for each object with metadata.
+type diskSidecar struct {
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// ContentType is stored only if it differs from the type by extension.
+	ContentType string `json:"content_type,omitempty"`
+	// ExpiresAt is set by WithTTL.
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+func (s diskSidecar) expired() bool {
+	return s.ExpiresAt != nil && !s.ExpiresAt.After(time.Now())
+}
+
+func (s diskSidecar) expiresAt() time.Time {
+	if s.ExpiresAt == nil {
+		return time.Time{}
+	}
+	return *s.ExpiresAt
+}
+
+// contentType returns the content type of key.
+func (s diskSidecar) contentType(key string) string {
+	if s.ContentType != "" {
+		return s.ContentType
+	}
+	return MimeTypeByExtension(path.Ext(key))
+}
 
 type disk struct {
 	dir      string
@@ -23,7 +63,8 @@ type disk struct {
 }
 
 // NewDiskService creates a new disk service.
-// dir is the directory to store the files.
+// dir is the directory to store the files. Keys under ".metadata/" and ".tmp/" are reserved for
+// internal files and rejected with ErrInvalidKey.
 func NewDiskService(dir string, endpoint string) (Service, error) {
 	_, err := url.Parse(endpoint)
 	if err != nil {
@@ -37,22 +78,41 @@ func NewDiskService(dir string, endpoint string) (Service, error) {
 }
 
 func (d *disk) Upload(ctx context.Context, key string, reader io.Reader) error {
+	if err := checkDiskKey(key); err != nil {
+		return err
+	}
 	p, err := d.makePathFor(key)
 	if err != nil {
 		return err
 	}
 
-	out, err := os.Create(p)
+	contentType, reader, err := detectUploadContentType(ctx, key, reader)
+	if err != nil {
+		return err
+	}
+
+	err = d.writeFile(p, reader)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, reader)
-	return err
+	sidecar := diskSidecar{Metadata: metadataFromContext(ctx), Tags: tagsFromContext(ctx)}
+	if contentType != MimeTypeByExtension(path.Ext(key)) {
+		sidecar.ContentType = contentType
+	}
+	if expiresAt := expiresAtFromContext(ctx); !expiresAt.IsZero() {
+		sidecar.ExpiresAt = &expiresAt
+	}
+	return d.writeSidecar(key, sidecar)
 }
 
 func (d *disk) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := checkDiskKey(key); err != nil {
+		return nil, err
+	}
+	if err := d.checkExpired("open", key); err != nil {
+		return nil, err
+	}
 	f, err := os.Open(d.pathFor(key))
 	if err != nil {
 		return nil, err
@@ -61,6 +121,12 @@ func (d *disk) Download(ctx context.Context, key string) (io.ReadCloser, error)
 }
 
 func (d *disk) Copy(ctx context.Context, src string, dst string) error {
+	if err := errors.Join(checkDiskKey(src), checkDiskKey(dst)); err != nil {
+		return err
+	}
+	if err := d.checkExpired("copy", src); err != nil {
+		return err
+	}
 	f, err := os.Open(d.pathFor(src))
 	if err != nil {
 		return err
@@ -72,23 +138,46 @@ func (d *disk) Copy(ctx context.Context, src string, dst string) error {
 		return err
 	}
 
-	out, err := os.Create(p)
+	err = d.writeFile(p, f)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, f)
-	return err
+	sidecar, err := d.readSidecar(src)
+	if err != nil {
+		return err
+	}
+	if md := metadataFromContext(ctx); md != nil {
+		sidecar.Metadata = md
+	}
+	if ct := contentTypeFromContext(ctx); ct != "" {
+		sidecar.ContentType = ct
+	}
+	if expiresAt := expiresAtFromContext(ctx); !expiresAt.IsZero() {
+		sidecar.ExpiresAt = &expiresAt
+	}
+	if tags := tagsFromContext(ctx); tags != nil {
+		sidecar.Tags = tags
+	}
+	// the type by extension of dst may differ from src
+	if ct := sidecar.contentType(src); ct != MimeTypeByExtension(path.Ext(dst)) {
+		sidecar.ContentType = ct
+	} else {
+		sidecar.ContentType = ""
+	}
+	return d.writeSidecar(dst, sidecar)
 }
 
 func (d *disk) Delete(ctx context.Context, key string) error {
+	if err := checkDiskKey(key); err != nil {
+		return err
+	}
 	p := d.pathFor(key)
 	err := os.Remove(p)
 	if err != nil && !os.IsNotExist(err) {
 		return pkgerr.WithStack(err)
 	}
-	return nil
+	return d.removeSidecar(key)
 }
 
 func (d *disk) DeleteBatch(ctx context.Context, keys []string) error {
@@ -103,13 +192,25 @@ func (d *disk) DeleteBatch(ctx context.Context, keys []string) error {
 }
 
 func (d *disk) DeletePrefixed(ctx context.Context, prefix string) error {
+	if err := checkDiskKey(prefix); err != nil {
+		return err
+	}
 	root := os.DirFS(d.dir)
 	matches, err := fs.Glob(root, fmt.Sprintf("%s*", prefix))
 	if err != nil {
 		return pkgerr.WithStack(err)
 	}
+	sidecars, err := fs.Glob(root, diskMetadataDir+"/"+prefix+"*")
+	if err != nil {
+		return pkgerr.WithStack(err)
+	}
+	matches = append(matches, sidecars...)
 
 	for _, match := range matches {
+		// the glob of an empty prefix matches the internal directories too
+		if match == diskMetadataDir || match == diskTempDir {
+			continue
+		}
 		p := filepath.Join(d.dir, match)
 		err := os.Remove(p)
 		if err != nil {
@@ -121,7 +222,13 @@ func (d *disk) DeletePrefixed(ctx context.Context, prefix string) error {
 }
 
 func (d *disk) Exist(ctx context.Context, key string) (bool, error) {
+	if err := checkDiskKey(key); err != nil {
+		return false, err
+	}
 	_, err := os.Stat(d.pathFor(key))
+	if err == nil {
+		err = d.checkExpired("stat", key)
+	}
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return false, nil
@@ -132,12 +239,176 @@ func (d *disk) Exist(ctx context.Context, key string) (bool, error) {
 	return true, nil
 }
 
+func (d *disk) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	if err := checkDiskKey(key); err != nil {
+		return ObjectInfo{}, err
+	}
+	fi, err := os.Stat(d.pathFor(key))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	sidecar, err := d.readSidecar(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	if sidecar.expired() {
+		return ObjectInfo{}, notExistError("stat", key)
+	}
+
+	return ObjectInfo{
+		Key:          key,
+		Size:         fi.Size(),
+		ContentType:  sidecar.contentType(key),
+		LastModified: fi.ModTime(),
+		Metadata:     sidecar.Metadata,
+		ExpiresAt:    sidecar.expiresAt(),
+	}, nil
+}
+
+func (d *disk) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	if err := checkDiskKey(prefix); err != nil {
+		return err
+	}
+	// walk from the deepest directory of prefix
+	root := path.Dir(prefix)
+	if strings.HasSuffix(prefix, "/") {
+		root = strings.TrimSuffix(prefix, "/")
+	}
+
+	err := fs.WalkDir(os.DirFS(d.dir), root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			if p == diskMetadataDir || p == diskTempDir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasPrefix(p, prefix) {
+			return nil
+		}
+
+		fi, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		sidecar, err := d.readSidecar(p)
+		if err != nil {
+			return err
+		}
+		if sidecar.expired() {
+			return nil
+		}
+		return fn(ObjectInfo{
+			Key:          p,
+			Size:         fi.Size(),
+			ContentType:  sidecar.contentType(p),
+			Metadata:     sidecar.Metadata,
+			ExpiresAt:    sidecar.expiresAt(),
+			LastModified: fi.ModTime(),
+		})
+	})
+	return pkgerr.WithStack(err)
+}
+
+// DeleteExpired deletes objects expired by WithTTL.
+func (d *disk) DeleteExpired(ctx context.Context) (int, error) {
+	deleted := 0
+	err := fs.WalkDir(os.DirFS(d.dir), diskMetadataDir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || !strings.HasSuffix(p, ".json") {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		key := strings.TrimSuffix(strings.TrimPrefix(p, diskMetadataDir+"/"), ".json")
+		sidecar, err := d.readSidecar(key)
+		if err != nil {
+			return err
+		}
+		if !sidecar.expired() {
+			return nil
+		}
+		err = d.Delete(ctx, key)
+		if err != nil {
+			return err
+		}
+		deleted++
+		return nil
+	})
+	return deleted, pkgerr.WithStack(err)
+}
+
+func (d *disk) GetTags(ctx context.Context, key string) (map[string]string, error) {
+	if _, err := d.Stat(ctx, key); err != nil {
+		return nil, err
+	}
+	sidecar, err := d.readSidecar(key)
+	if err != nil {
+		return nil, err
+	}
+	return sidecar.Tags, nil
+}
+
+func (d *disk) SetTags(ctx context.Context, key string, tags map[string]string) error {
+	if _, err := d.Stat(ctx, key); err != nil {
+		return err
+	}
+	sidecar, err := d.readSidecar(key)
+	if err != nil {
+		return err
+	}
+	sidecar.Tags = copyMetadata(tags)
+	return d.writeSidecar(key, sidecar)
+}
+
+func (d *disk) DeleteTags(ctx context.Context, key string) error {
+	return d.SetTags(ctx, key, nil)
+}
+
+// checkExpired returns an error matching fs.ErrNotExist if key is expired.
+func (d *disk) checkExpired(op string, key string) error {
+	sidecar, err := d.readSidecar(key)
+	if err != nil {
+		return err
+	}
+	if sidecar.expired() {
+		return notExistError(op, key)
+	}
+	return nil
+}
+
 func (d *disk) URL(key string) string {
 	return URL(d.endpoint, key)
 }
 
 func (d *disk) SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error) {
-	return "", nil, errors.New("not supported")
+	return "", nil, ErrNotSupported
+}
+
+// checkDiskKey rejects keys and prefixes escaping dir or under the internal directories, so sidecars
+// of other objects can't be forged.
+func checkDiskKey(key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	first, _, _ := strings.Cut(path.Clean(key), "/")
+	if first == diskMetadataDir || first == diskTempDir {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidKey, key)
+	}
+	return nil
 }
 
 func (d *disk) pathFor(key string) string {
@@ -152,3 +423,75 @@ func (d *disk) makePathFor(key string) (string, error) {
 	}
 	return p, nil
 }
+
+// writeFile writes reader to a temp file renamed to p, so readers of p never see a partial file
+// and p is kept if writing fails.
+func (d *disk) writeFile(p string, reader io.Reader) error {
+	dir := filepath.Join(d.dir, diskTempDir)
+	err := os.MkdirAll(dir, 0750)
+	if err != nil && !os.IsExist(err) {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "write-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, reader)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (d *disk) sidecarPathFor(key string) string {
+	return filepath.Join(d.dir, diskMetadataDir, key+".json")
+}
+
+func (d *disk) readSidecar(key string) (diskSidecar, error) {
+	var sidecar diskSidecar
+	b, err := os.ReadFile(d.sidecarPathFor(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return sidecar, nil
+		}
+		return sidecar, pkgerr.WithStack(err)
+	}
+
+	err = json.Unmarshal(b, &sidecar)
+	return sidecar, pkgerr.WithStack(err)
+}
+
+// writeSidecar writes the sidecar of key, or removes it if empty.
+func (d *disk) writeSidecar(key string, sidecar diskSidecar) error {
+	if len(sidecar.Metadata) == 0 && sidecar.ContentType == "" && sidecar.ExpiresAt == nil && len(sidecar.Tags) == 0 {
+		return d.removeSidecar(key)
+	}
+
+	b, err := json.Marshal(sidecar)
+	if err != nil {
+		return pkgerr.WithStack(err)
+	}
+
+	p := d.sidecarPathFor(key)
+	err = os.MkdirAll(filepath.Dir(p), 0750)
+	if err != nil {
+		return pkgerr.WithStack(err)
+	}
+	return pkgerr.WithStack(os.WriteFile(p, b, 0640))
+}
+
+func (d *disk) removeSidecar(key string) error {
+	err := os.Remove(d.sidecarPathFor(key))
+	if err != nil && !os.IsNotExist(err) {
+		return pkgerr.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskService_metadata(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewDiskService(t.TempDir(), "http://localhost/disk")
+	require.NoError(t, err)
+
+	ctx := WithMetadata(context.TODO(), map[string]string{"foo": "bar"})
+	err = service.Upload(ctx, "test/a.txt", strings.NewReader("hello world"))
+	require.NoError(t, err)
+
+	info, err := Stat(context.TODO(), service, "test/a.txt")
+	require.NoError(t, err)
+	require.Equal(t, int64(11), info.Size)
+	require.Equal(t, "text/plain; charset=utf-8", info.ContentType)
+	require.Equal(t, map[string]string{"foo": "bar"}, info.Metadata)
+
+	err = service.Copy(context.TODO(), "test/a.txt", "test/b.txt")
+	require.NoError(t, err)
+	info, err = Stat(context.TODO(), service, "test/b.txt")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"foo": "bar"}, info.Metadata)
+
+	err = service.Delete(context.TODO(), "test/a.txt")
+	require.NoError(t, err)
+	_, err = Stat(context.TODO(), service, "test/a.txt")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	// overwriting without metadata removes metadata
+	err = service.Upload(context.TODO(), "test/b.txt", strings.NewReader("hello"))
+	require.NoError(t, err)
+	info, err = Stat(context.TODO(), service, "test/b.txt")
+	require.NoError(t, err)
+	require.Nil(t, info.Metadata)
+}
+
+func TestDiskService_deletePrefixed(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	service, err := NewDiskService(dir, "http://localhost/disk")
+	require.NoError(t, err)
+
+	ctx := WithMetadata(context.TODO(), map[string]string{"foo": "bar"})
+	require.NoError(t, service.Upload(ctx, "a.txt", strings.NewReader("a")))
+	require.NoError(t, service.Upload(ctx, "b.txt", strings.NewReader("b")))
+
+	require.NoError(t, service.DeletePrefixed(context.TODO(), ""))
+	exist, err := service.Exist(context.TODO(), "a.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+	_, err = os.Stat(filepath.Join(dir, diskMetadataDir, "a.txt.json"))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = os.Stat(filepath.Join(dir, diskMetadataDir))
+	require.NoError(t, err)
+
+	require.NoError(t, service.Upload(ctx, "c.txt", strings.NewReader("c")))
+	info, err := Stat(context.TODO(), service, "c.txt")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"foo": "bar"}, info.Metadata)
+}
+
+func TestDiskService_reservedKeys(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewDiskService(t.TempDir(), "http://localhost/disk")
+	require.NoError(t, err)
+	ctx := context.TODO()
+	require.NoError(t, service.Upload(WithContentType(ctx, "text/plain"), "a.jpg", strings.NewReader("a")))
+
+	// sidecars and temp files can't be written or read as objects
+	for _, key := range []string{".metadata/a.jpg.json", ".tmp/write-1", "./.metadata/a.jpg.json", "a/../.metadata/a.jpg.json"} {
+		require.ErrorIs(t, service.Upload(ctx, key, strings.NewReader(`{"content_type":"text/html"}`)), ErrInvalidKey, key)
+		require.ErrorIs(t, service.Copy(ctx, "a.jpg", key), ErrInvalidKey, key)
+		_, err := service.Download(ctx, key)
+		require.ErrorIs(t, err, ErrInvalidKey, key)
+		require.ErrorIs(t, service.Delete(ctx, key), ErrInvalidKey, key)
+	}
+	info, err := Stat(ctx, service, "a.jpg")
+	require.NoError(t, err)
+	require.Equal(t, "text/plain", info.ContentType)
+
+	require.ErrorIs(t, service.DeletePrefixed(ctx, ".metadata/"), ErrInvalidKey)
+	require.ErrorIs(t, List(ctx, service, ".metadata/", func(obj ObjectInfo) error { return nil }), ErrInvalidKey)
+	var keys []string
+	require.NoError(t, List(ctx, service, "", func(obj ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	}))
+	require.Equal(t, []string{"a.jpg"}, keys)
+}
+
+func TestDiskService_list(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewDiskService(t.TempDir(), "http://localhost/disk")
+	require.NoError(t, err)
+
+	ctx := WithMetadata(context.TODO(), map[string]string{"foo": "bar"})
+	for _, key := range []string{"a.txt", "docs/b.txt", "docs/c/d.txt", "e/f.txt"} {
+		require.NoError(t, service.Upload(ctx, key, strings.NewReader(key)))
+	}
+
+	list := func(prefix string) []string {
+		var keys []string
+		err := List(context.TODO(), service, prefix, func(obj ObjectInfo) error {
+			keys = append(keys, obj.Key)
+			require.Equal(t, int64(len(obj.Key)), obj.Size)
+			return nil
+		})
+		require.NoError(t, err)
+		return keys
+	}
+
+	require.Equal(t, []string{"a.txt", "docs/b.txt", "docs/c/d.txt", "e/f.txt"}, list(""))
+	require.Equal(t, []string{"docs/b.txt", "docs/c/d.txt"}, list("docs/"))
+	require.Equal(t, []string{"docs/c/d.txt"}, list("docs/c"))
+	require.Empty(t, list("missing/"))
+}
+
+func TestDiskService_ttl(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	service, err := NewDiskService(dir, "http://localhost/disk")
+	require.NoError(t, err)
+	ctx := context.TODO()
+
+	require.NoError(t, service.Upload(WithTTL(ctx, time.Millisecond), "tmp/a.txt", strings.NewReader("a")))
+	require.NoError(t, service.Upload(WithTTL(ctx, time.Hour), "tmp/b.txt", strings.NewReader("b")))
+	require.NoError(t, service.Upload(ctx, "tmp/c.txt", strings.NewReader("c")))
+	info, err := Stat(ctx, service, "tmp/b.txt")
+	require.NoError(t, err)
+	require.False(t, info.ExpiresAt.IsZero())
+	time.Sleep(5 * time.Millisecond)
+
+	// expired objects are treated as deleted before sweeping
+	exist, err := service.Exist(ctx, "tmp/a.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+	_, err = service.Download(ctx, "tmp/a.txt")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	n, err := DeleteExpired(ctx, service)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	_, err = os.Stat(filepath.Join(dir, "tmp/a.txt"))
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	var keys []string
+	err = List(ctx, service, "tmp/", func(obj ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"tmp/b.txt", "tmp/c.txt"}, keys)
+}
+
+func TestDiskService_tags(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewDiskService(t.TempDir(), "http://localhost/disk")
+	require.NoError(t, err)
+	ctx := context.TODO()
+
+	err = service.Upload(WithTags(ctx, map[string]string{"pii": "true"}), "a.txt", strings.NewReader("a"))
+	require.NoError(t, err)
+	tags, err := GetTags(ctx, service, "a.txt")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"pii": "true"}, tags)
+
+	// tags are copied unless replaced
+	require.NoError(t, service.Copy(ctx, "a.txt", "b.txt"))
+	require.NoError(t, service.Copy(WithTags(ctx, map[string]string{"tier": "cold"}), "a.txt", "c.txt"))
+	tags, err = GetTags(ctx, service, "b.txt")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"pii": "true"}, tags)
+	tags, err = GetTags(ctx, service, "c.txt")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"tier": "cold"}, tags)
+
+	require.NoError(t, SetTags(ctx, service, "a.txt", map[string]string{"tier": "cold"}))
+	tags, err = GetTags(ctx, service, "a.txt")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"tier": "cold"}, tags)
+
+	require.NoError(t, DeleteTags(ctx, service, "a.txt"))
+	tags, err = GetTags(ctx, service, "a.txt")
+	require.NoError(t, err)
+	require.Empty(t, tags)
+
+	require.ErrorIs(t, SetTags(ctx, service, "missing.txt", map[string]string{"a": "b"}), fs.ErrNotExist)
+}
@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// metadata keys of encrypted objects
+	MetadataEncryption      = "encryption"
+	MetadataEncryptionKeyID = "encryption-key-id"
+	MetadataEncryptionKey   = "encryption-key"
+	MetadataEncryptionNonce = "encryption-nonce"
+
+	encryptionAlgorithm = "aes-gcm-stream"
+)
+
+// ErrEncrypted is returned when a plain URL of an encrypted object is requested.
+var ErrEncrypted = errors.New("object is encrypted")
+
+// ErrNotEncrypted is returned when an object without encryption metadata is downloaded.
+var ErrNotEncrypted = errors.New("object is not encrypted")
+
+var _ Service = (*encryptedService)(nil)
+
+type encryptedService struct {
+	service Service
+	keys    KeyProvider
+}
+
+// NewEncryptedService wraps service to encrypt files on upload and decrypt them on download,
+// so the backend never sees plaintext.
+//
+// Each file is encrypted by a random data key with AES-GCM in chunks of 64KB. The data key is encrypted by
+// a key of keys, and stored with the key ID in metadata, so service must implement Stater.
+// Files without encryption metadata fail to download with ErrNotEncrypted, instead of being returned as is.
+//
+// URL always returns "" and SignURL refuses PUT and encrypted objects, because they would bypass encryption.
+func NewEncryptedService(service Service, keys KeyProvider) Service {
+	return &encryptedService{
+		service: service,
+		keys:    keys,
+	}
+}
+
+func (s *encryptedService) Upload(ctx context.Context, key string, reader io.Reader) error {
+	keyID, kek, err := s.keys.EncryptionKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	// the content type is detected from plaintext, the service would sniff ciphertext
+	contentType, reader, err := detectUploadContentType(ctx, key, reader)
+	if err != nil {
+		return err
+	}
+	ctx = WithContentType(ctx, contentType)
+
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return err
+	}
+	prefix := make([]byte, encryptionNoncePrefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return err
+	}
+	wrapped, err := wrapKey(kek, dataKey)
+	if err != nil {
+		return err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+
+	ctx = WithMetadata(ctx, map[string]string{
+		MetadataEncryption:      encryptionAlgorithm,
+		MetadataEncryptionKeyID: keyID,
+		MetadataEncryptionKey:   base64.StdEncoding.EncodeToString(wrapped),
+		MetadataEncryptionNonce: base64.StdEncoding.EncodeToString(prefix),
+	})
+	return s.service.Upload(ctx, key, newEncryptReader(reader, aead, prefix))
+}
+
+func (s *encryptedService) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	info, err := Stat(ctx, s.service, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isEncrypted(info) {
+		return nil, fmt.Errorf("%w: %s", ErrNotEncrypted, key)
+	}
+
+	reader, err := s.service.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, prefix, err := s.cipherOf(ctx, info)
+	if err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return newDecryptReader(reader, aead, prefix), nil
+}
+
+// Copy copies the encrypted file along with its encryption metadata.
+func (s *encryptedService) Copy(ctx context.Context, src string, dst string) error {
+	info, err := Stat(ctx, s.service, src)
+	if err != nil {
+		return err
+	}
+
+	return s.service.Copy(WithMetadata(ctx, info.Metadata), src, dst)
+}
+
+func (s *encryptedService) Delete(ctx context.Context, key string) error {
+	return s.service.Delete(ctx, key)
+}
+
+func (s *encryptedService) DeleteBatch(ctx context.Context, keys []string) error {
+	return s.service.DeleteBatch(ctx, keys)
+}
+
+func (s *encryptedService) DeletePrefixed(ctx context.Context, prefix string) error {
+	return s.service.DeletePrefixed(ctx, prefix)
+}
+
+func (s *encryptedService) Exist(ctx context.Context, key string) (bool, error) {
+	return s.service.Exist(ctx, key)
+}
+
+// Stat returns the plaintext size of encrypted objects.
+func (s *encryptedService) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := Stat(ctx, s.service, key)
+	if err != nil {
+		return info, err
+	}
+	if isEncrypted(info) {
+		info.Size = decryptedSize(info.Size)
+	}
+	return info, nil
+}
+
+// List returns the stored size of objects, which includes the encryption overhead.
+func (s *encryptedService) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	return List(ctx, s.service, prefix, fn)
+}
+
+// URL returns "", encrypted files are not readable by URL.
+func (s *encryptedService) URL(key string) string {
+	return ""
+}
+
+func (s *encryptedService) SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error) {
+	switch method {
+	case http.MethodPut:
+		return "", nil, ErrEncrypted
+	case http.MethodGet, http.MethodHead:
+		info, err := Stat(ctx, s.service, key)
+		if err != nil {
+			return "", nil, err
+		}
+		if isEncrypted(info) {
+			return "", nil, ErrEncrypted
+		}
+	}
+
+	return s.service.SignURL(ctx, key, method, expiresIn)
+}
+
+func (s *encryptedService) cipherOf(ctx context.Context, info ObjectInfo) (cipher.AEAD, []byte, error) {
+	kek, err := s.keys.DecryptionKey(ctx, info.Metadata[MetadataEncryptionKeyID])
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(info.Metadata[MetadataEncryptionKey])
+	if err != nil {
+		return nil, nil, err
+	}
+	prefix, err := base64.StdEncoding.DecodeString(info.Metadata[MetadataEncryptionNonce])
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(prefix) != encryptionNoncePrefixSize {
+		return nil, nil, errors.New("invalid encryption nonce")
+	}
+
+	dataKey, err := unwrapKey(kek, wrapped)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, prefix, nil
+}
+
+func isEncrypted(info ObjectInfo) bool {
+	return info.Metadata[MetadataEncryption] == encryptionAlgorithm
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedService(t *testing.T) {
+	t.Parallel()
+
+	backend, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+
+	key1 := bytes.Repeat([]byte{1}, 32)
+	key2 := bytes.Repeat([]byte{2}, 32)
+	service := NewEncryptedService(backend, NewStaticKeyProvider("k1", key1))
+
+	download := func(service Service, key string) ([]byte, error) {
+		reader, err := service.Download(context.TODO(), key)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+
+	for _, size := range []int{0, 10, encryptionChunkSize, 3*encryptionChunkSize + 7} {
+		plaintext := make([]byte, size)
+		_, err := rand.Read(plaintext)
+		require.NoError(t, err)
+
+		err = service.Upload(context.TODO(), "secret.bin", bytes.NewReader(plaintext))
+		require.NoError(t, err)
+
+		stored, err := download(backend, "secret.bin")
+		require.NoError(t, err)
+		require.NotEqual(t, plaintext, stored)
+
+		b, err := download(service, "secret.bin")
+		require.NoError(t, err)
+		require.Equal(t, plaintext, b)
+
+		info, err := Stat(context.TODO(), service, "secret.bin")
+		require.NoError(t, err)
+		require.Equal(t, int64(size), info.Size)
+		require.Equal(t, "k1", info.Metadata[MetadataEncryptionKeyID])
+	}
+
+	t.Run("key rotation", func(t *testing.T) {
+		rotated := NewEncryptedService(backend, NewKeyRing("k2", map[string][]byte{"k1": key1, "k2": key2}))
+		b, err := download(rotated, "secret.bin")
+		require.NoError(t, err)
+		require.Len(t, b, 3*encryptionChunkSize+7)
+
+		require.NoError(t, rotated.Upload(context.TODO(), "new.txt", bytes.NewReader([]byte("hello world"))))
+		_, err = download(service, "new.txt")
+		require.ErrorIs(t, err, ErrKeyNotFound)
+	})
+
+	t.Run("copy", func(t *testing.T) {
+		require.NoError(t, service.Copy(context.TODO(), "secret.bin", "copied.bin"))
+		b, err := download(service, "copied.bin")
+		require.NoError(t, err)
+		require.Len(t, b, 3*encryptionChunkSize+7)
+	})
+
+	t.Run("detect truncation", func(t *testing.T) {
+		require.NoError(t, service.Upload(context.TODO(), "truncated.bin", bytes.NewReader(make([]byte, 2*encryptionChunkSize))))
+		stored, err := download(backend, "truncated.bin")
+		require.NoError(t, err)
+		info, err := Stat(context.TODO(), backend, "truncated.bin")
+		require.NoError(t, err)
+		ctx := WithMetadata(context.TODO(), info.Metadata)
+		require.NoError(t, backend.Upload(ctx, "truncated.bin", bytes.NewReader(stored[:encryptionChunkSize+16])))
+
+		_, err = download(service, "truncated.bin")
+		require.Error(t, err)
+	})
+
+	t.Run("content type", func(t *testing.T) {
+		require.NoError(t, service.Upload(context.TODO(), "page", bytes.NewReader([]byte("<!DOCTYPE html><p>hello</p>"))))
+		info, err := Stat(context.TODO(), backend, "page")
+		require.NoError(t, err)
+		require.Equal(t, "text/html; charset=utf-8", info.ContentType)
+
+		require.NoError(t, service.Upload(context.TODO(), "data.json", bytes.NewReader([]byte(`{"hello":"world"}`))))
+		info, err = Stat(context.TODO(), backend, "data.json")
+		require.NoError(t, err)
+		require.Equal(t, "application/json", info.ContentType)
+	})
+
+	t.Run("refuse plaintext", func(t *testing.T) {
+		require.NoError(t, backend.Upload(context.TODO(), "plain.txt", bytes.NewReader([]byte("hello world"))))
+		_, err := download(service, "plain.txt")
+		require.ErrorIs(t, err, ErrNotEncrypted)
+	})
+
+	t.Run("refuse urls", func(t *testing.T) {
+		require.Empty(t, service.URL("secret.bin"))
+		_, _, err := service.SignURL(context.TODO(), "secret.bin", http.MethodGet, 0)
+		require.ErrorIs(t, err, ErrEncrypted)
+		_, _, err = service.SignURL(context.TODO(), "other.bin", http.MethodPut, 0)
+		require.ErrorIs(t, err, ErrEncrypted)
+	})
+}
+
+func TestPrefixKeyProvider(t *testing.T) {
+	t.Parallel()
+
+	provider := NewPrefixKeyProvider(map[string]KeyProvider{
+		"":          NewStaticKeyProvider("default", bytes.Repeat([]byte{1}, 32)),
+		"tenant-a/": NewStaticKeyProvider("a", bytes.Repeat([]byte{2}, 32)),
+	})
+
+	keyID, _, err := provider.EncryptionKey(context.TODO(), "tenant-a/file.txt")
+	require.NoError(t, err)
+	require.Equal(t, "a", keyID)
+
+	keyID, _, err = provider.EncryptionKey(context.TODO(), "tenant-b/file.txt")
+	require.NoError(t, err)
+	require.Equal(t, "default", keyID)
+
+	key, err := provider.DecryptionKey(context.TODO(), "a")
+	require.NoError(t, err)
+	require.Equal(t, bytes.Repeat([]byte{2}, 32), key)
+
+	_, err = provider.DecryptionKey(context.TODO(), "unknown")
+	require.ErrorIs(t, err, ErrKeyNotFound)
+}
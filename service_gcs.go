@@ -3,11 +3,16 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	gstorage "cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 )
 
@@ -48,6 +53,9 @@ func gcsACLFromContext(ctx context.Context) []acl {
 	return nil
 }
 
+var _ Tagger = (*gcsService)(nil)
+var _ Versioner = (*gcsService)(nil)
+
 type gcsService struct {
 	client   *gstorage.Client
 	bucket   string
@@ -76,11 +84,27 @@ func NewGCSServiceWithClient(bucket string, endpoint string, client *gstorage.Cl
 }
 
 func (s *gcsService) Upload(ctx context.Context, key string, reader io.Reader) error {
+	if err := checkTTLSupported(ctx); err != nil {
+		return err
+	}
+
 	bucket := s.client.Bucket(s.bucket)
 	obj := bucket.Object(key)
 
+	contentType, reader, err := detectUploadContentType(ctx, key, reader)
+	if err != nil {
+		return err
+	}
+
+	metadata := metadataFromContext(ctx)
+	if err := gcsCheckMetadata(metadata); err != nil {
+		return err
+	}
+
 	writer := obj.NewWriter(ctx)
-	_, err := io.Copy(writer, reader)
+	writer.ContentType = contentType
+	writer.Metadata = gcsJoinMetadata(metadata, tagsFromContext(ctx))
+	_, err = io.Copy(writer, reader)
 	if err != nil {
 		writer.Close()
 		return err
@@ -111,11 +135,34 @@ func (s *gcsService) Download(ctx context.Context, key string) (io.ReadCloser, e
 }
 
 func (s *gcsService) Copy(ctx context.Context, src string, dst string) error {
+	if err := checkTTLSupported(ctx); err != nil {
+		return err
+	}
+
 	bucket := s.client.Bucket(s.bucket)
 	srcObj := bucket.Object(src)
 	dstObj := bucket.Object(dst)
 
 	copier := dstObj.CopierFrom(srcObj)
+	// metadata and tags share GCS metadata, keep the part not specified
+	md, tags := metadataFromContext(ctx), tagsFromContext(ctx)
+	if err := gcsCheckMetadata(md); err != nil {
+		return err
+	}
+	if md != nil || tags != nil {
+		attrs, err := srcObj.Attrs(ctx)
+		if err != nil {
+			return err
+		}
+		srcMetadata, srcTags := gcsSplitMetadata(attrs.Metadata)
+		if md == nil {
+			md = srcMetadata
+		}
+		if tags == nil {
+			tags = srcTags
+		}
+		copier.Metadata = gcsJoinMetadata(md, tags)
+	}
 	_, err := copier.Run(ctx)
 	if err != nil {
 		return err
@@ -191,10 +238,260 @@ func (s *gcsService) Exist(ctx context.Context, key string) (bool, error) {
 	return true, nil
 }
 
+func (s *gcsService) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	bucket := s.client.Bucket(s.bucket)
+	attrs, err := bucket.Object(key).Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, gstorage.ErrObjectNotExist) {
+			return ObjectInfo{}, notExistError("stat", key)
+		}
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{
+		Key:          key,
+		Size:         attrs.Size,
+		ContentType:  attrs.ContentType,
+		LastModified: attrs.Updated,
+		Metadata:     gcsMetadata(attrs.Metadata),
+	}, nil
+}
+
+func (s *gcsService) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	bucket := s.client.Bucket(s.bucket)
+	iter := bucket.Objects(ctx, &gstorage.Query{
+		Prefix: prefix,
+	})
+
+	for {
+		attrs, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		err = fn(ObjectInfo{
+			Key:          attrs.Name,
+			Size:         attrs.Size,
+			ContentType:  attrs.ContentType,
+			LastModified: attrs.Updated,
+			Metadata:     gcsMetadata(attrs.Metadata),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (s *gcsService) URL(key string) string {
 	return URL(s.endpoint, key)
 }
 
 func (s *gcsService) SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error) {
-	return "", nil, errors.New("not supported")
+	return "", nil, ErrNotSupported
+}
+
+// isRetryableGCSError reports whether err is a 408, 429, 5xx or connection error of the GCS client.
+func isRetryableGCSError(err error) bool {
+	return gstorage.ShouldRetry(err)
+}
+
+func (s *gcsService) GetTags(ctx context.Context, key string) (map[string]string, error) {
+	attrs, err := s.client.Bucket(s.bucket).Object(key).Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, gstorage.ErrObjectNotExist) {
+			return nil, notExistError("get tags", key)
+		}
+		return nil, err
+	}
+
+	_, tags := gcsSplitMetadata(attrs.Metadata)
+	return tags, nil
+}
+
+func (s *gcsService) SetTags(ctx context.Context, key string, tags map[string]string) error {
+	obj := s.client.Bucket(s.bucket).Object(key)
+	attrs, err := obj.Attrs(ctx)
+	if err != nil {
+		if errors.Is(err, gstorage.ErrObjectNotExist) {
+			return notExistError("set tags", key)
+		}
+		return err
+	}
+
+	// metadata with empty values are deleted by update
+	update := make(map[string]string)
+	_, old := gcsSplitMetadata(attrs.Metadata)
+	for k := range old {
+		update[gcsTagPrefix+k] = ""
+	}
+	for k, v := range tags {
+		update[gcsTagPrefix+k] = v
+	}
+	if len(update) == 0 {
+		return nil
+	}
+	_, err = obj.Update(ctx, gstorage.ObjectAttrsToUpdate{Metadata: update})
+	return err
+}
+
+func (s *gcsService) DeleteTags(ctx context.Context, key string) error {
+	return s.SetTags(ctx, key, nil)
+}
+
+// gcsTagPrefix prefixes metadata keys of tags, GCS has no object tags. Metadata keys with the prefix are
+// reserved, so they can't be mistaken for tags.
+const gcsTagPrefix = "storage-tag-"
+
+// gcsCheckMetadata rejects metadata keys reserved for tags.
+func gcsCheckMetadata(metadata map[string]string) error {
+	for k := range metadata {
+		if strings.HasPrefix(k, gcsTagPrefix) {
+			return fmt.Errorf("metadata key %q is reserved for tags, the prefix %q is not allowed", k, gcsTagPrefix)
+		}
+	}
+	return nil
+}
+
+func gcsJoinMetadata(metadata, tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return metadata
+	}
+	joined := make(map[string]string, len(metadata)+len(tags))
+	for k, v := range metadata {
+		joined[k] = v
+	}
+	for k, v := range tags {
+		joined[gcsTagPrefix+k] = v
+	}
+	return joined
+}
+
+func gcsSplitMetadata(joined map[string]string) (metadata, tags map[string]string) {
+	for k, v := range joined {
+		if tag, ok := strings.CutPrefix(k, gcsTagPrefix); ok {
+			if tags == nil {
+				tags = make(map[string]string)
+			}
+			tags[tag] = v
+			continue
+		}
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[k] = v
+	}
+	return metadata, tags
+}
+
+// gcsMetadata returns metadata without tags.
+func gcsMetadata(joined map[string]string) map[string]string {
+	metadata, _ := gcsSplitMetadata(joined)
+	return metadata
+}
+
+// ListVersions returns generations of key, VersionID is the generation.
+func (s *gcsService) ListVersions(ctx context.Context, key string) ([]ObjectVersion, error) {
+	bucket := s.client.Bucket(s.bucket)
+	iter := bucket.Objects(ctx, &gstorage.Query{
+		Prefix:   key,
+		Versions: true,
+	})
+
+	var versions []ObjectVersion
+	for {
+		attrs, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if attrs.Name != key {
+			continue
+		}
+
+		versions = append(versions, ObjectVersion{
+			Key:          key,
+			VersionID:    strconv.FormatInt(attrs.Generation, 10),
+			Size:         attrs.Size,
+			LastModified: attrs.Updated,
+			// noncurrent generations have the time they became noncurrent
+			IsLatest: attrs.Deleted.IsZero(),
+		})
+	}
+
+	// generations increase over time
+	sort.SliceStable(versions, func(i, j int) bool {
+		a, _ := strconv.ParseInt(versions[i].VersionID, 10, 64)
+		b, _ := strconv.ParseInt(versions[j].VersionID, 10, 64)
+		return a > b
+	})
+	return versions, nil
+}
+
+func (s *gcsService) DownloadVersion(ctx context.Context, key string, versionID string) (io.ReadCloser, error) {
+	obj, err := s.generation(key, versionID)
+	if err != nil {
+		return nil, err
+	}
+	r, err := obj.NewReader(ctx)
+	if err != nil {
+		if isGCSNotFound(err) {
+			return nil, notExistError("download version", key)
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *gcsService) CopyVersion(ctx context.Context, key string, versionID string, dst string) error {
+	if err := checkTTLSupported(ctx); err != nil {
+		return err
+	}
+
+	src, err := s.generation(key, versionID)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Bucket(s.bucket).Object(dst).CopierFrom(src).Run(ctx)
+	if isGCSNotFound(err) {
+		return notExistError("copy version", key)
+	}
+	return err
+}
+
+func (s *gcsService) DeleteVersion(ctx context.Context, key string, versionID string) error {
+	obj, err := s.generation(key, versionID)
+	if err != nil {
+		return err
+	}
+	err = obj.Delete(ctx)
+	if isGCSNotFound(err) {
+		return notExistError("delete version", key)
+	}
+	return err
+}
+
+func (s *gcsService) RestoreVersion(ctx context.Context, key string, versionID string) error {
+	return s.CopyVersion(ctx, key, versionID, key)
+}
+
+// isGCSNotFound reports whether err is a not found error of GCS. Copies return the API error as is,
+// other operations return ErrObjectNotExist.
+func isGCSNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.Is(err, gstorage.ErrObjectNotExist) || errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+func (s *gcsService) generation(key string, versionID string) (*gstorage.ObjectHandle, error) {
+	generation, err := strconv.ParseInt(versionID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid generation %q: %w", versionID, err)
+	}
+	return s.client.Bucket(s.bucket).Object(key).Generation(generation), nil
 }
@@ -3,10 +3,14 @@ package storage
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"net/http"
 	"testing"
 
+	gstorage "cloud.google.com/go/storage"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
 )
 
 func TestGCSService(t *testing.T) {
@@ -72,3 +76,26 @@ func TestGCSService_uploadWithACL(t *testing.T) {
 	err = service.Upload(ctx, "test.txt", bytes.NewReader([]byte("hello world")))
 	require.NoError(t, err)
 }
+
+func TestGCSMetadataTags(t *testing.T) {
+	t.Parallel()
+
+	joined := gcsJoinMetadata(map[string]string{"owner": "1", "tag-line": "hello"}, map[string]string{"pii": "true"})
+	require.Equal(t, map[string]string{"owner": "1", "tag-line": "hello", "storage-tag-pii": "true"}, joined)
+
+	metadata, tags := gcsSplitMetadata(joined)
+	require.Equal(t, map[string]string{"owner": "1", "tag-line": "hello"}, metadata)
+	require.Equal(t, map[string]string{"pii": "true"}, tags)
+
+	require.NoError(t, gcsCheckMetadata(metadata))
+	require.Error(t, gcsCheckMetadata(map[string]string{"storage-tag-pii": "true"}))
+}
+
+func TestGCSNotFound(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, isGCSNotFound(gstorage.ErrObjectNotExist))
+	require.True(t, isGCSNotFound(fmt.Errorf("copy: %w", &googleapi.Error{Code: http.StatusNotFound})))
+	require.False(t, isGCSNotFound(&googleapi.Error{Code: http.StatusForbidden}))
+	require.False(t, isGCSNotFound(nil))
+}
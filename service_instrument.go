@@ -0,0 +1,316 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// InstrumentOptions configures the service created by NewInstrumentedService.
+type InstrumentOptions struct {
+	// Backend is the name reported in logs and metrics. Default is derived from the service, such as "s3".
+	Backend string
+	// Logger receives a record for every call, at debug level on success and error level on failure.
+	// Default is slog.Default().
+	Logger *slog.Logger
+	// Metrics records every call. Default is NewExpvarMetrics("storage").
+	Metrics Metrics
+}
+
+func (o InstrumentOptions) merge(options []InstrumentOptions) InstrumentOptions {
+	for _, opt := range options {
+		if opt.Backend != "" {
+			o.Backend = opt.Backend
+		}
+		if opt.Logger != nil {
+			o.Logger = opt.Logger
+		}
+		if opt.Metrics != nil {
+			o.Metrics = opt.Metrics
+		}
+	}
+	if o.Logger == nil {
+		o.Logger = slog.Default()
+	}
+	if o.Metrics == nil {
+		o.Metrics = NewExpvarMetrics("storage")
+	}
+	return o
+}
+
+type instrument struct {
+	backend string
+	logger  *slog.Logger
+	metrics Metrics
+}
+
+// observe records an operation started at start.
+func (i instrument) observe(ctx context.Context, op string, key string, start time.Time, bytes int64, err error) {
+	duration := time.Since(start)
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = OutcomeError
+	}
+
+	i.metrics.Record(OperationMetric{
+		Operation: op,
+		Backend:   i.backend,
+		Duration:  duration,
+		Bytes:     bytes,
+		Outcome:   outcome,
+	})
+
+	attrs := []slog.Attr{
+		slog.String("operation", op),
+		slog.String("backend", i.backend),
+		slog.String("key", key),
+		slog.Duration("duration", duration),
+		slog.Int64("bytes", bytes),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+		i.logger.LogAttrs(ctx, slog.LevelError, "storage operation failed", attrs...)
+		return
+	}
+	i.logger.LogAttrs(ctx, slog.LevelDebug, "storage operation", attrs...)
+}
+
+var _ Service = (*instrumentedService)(nil)
+
+type instrumentedService struct {
+	instrument
+	service Service
+}
+
+// NewInstrumentedService wraps service to log and record metrics of every call.
+func NewInstrumentedService(service Service, options ...InstrumentOptions) Service {
+	opts := InstrumentOptions{Backend: backendName(service)}.merge(options)
+	return &instrumentedService{
+		instrument: instrument{
+			backend: opts.Backend,
+			logger:  opts.Logger,
+			metrics: opts.Metrics,
+		},
+		service: service,
+	}
+}
+
+func (s *instrumentedService) Upload(ctx context.Context, key string, reader io.Reader) error {
+	start := time.Now()
+	counter, reader := newCountingReader(reader)
+	err := s.service.Upload(ctx, key, reader)
+	s.observe(ctx, "upload", key, start, counter.n, err)
+	return err
+}
+
+// Download records the operation when the returned reader is closed,
+// so the duration and bytes include reading the content.
+func (s *instrumentedService) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	start := time.Now()
+	reader, err := s.service.Download(ctx, key)
+	if err != nil {
+		s.observe(ctx, "download", key, start, 0, err)
+		return nil, err
+	}
+
+	return &observedReadCloser{
+		countingReader: countingReader{reader: reader},
+		closer:         reader,
+		observe: func(n int64, err error) {
+			s.observe(ctx, "download", key, start, n, err)
+		},
+	}, nil
+}
+
+func (s *instrumentedService) Copy(ctx context.Context, src string, dst string) error {
+	start := time.Now()
+	err := s.service.Copy(ctx, src, dst)
+	s.observe(ctx, "copy", dst, start, 0, err)
+	return err
+}
+
+func (s *instrumentedService) Delete(ctx context.Context, key string) error {
+	start := time.Now()
+	err := s.service.Delete(ctx, key)
+	s.observe(ctx, "delete", key, start, 0, err)
+	return err
+}
+
+func (s *instrumentedService) DeleteBatch(ctx context.Context, keys []string) error {
+	start := time.Now()
+	err := s.service.DeleteBatch(ctx, keys)
+	s.observe(ctx, "delete_batch", fmt.Sprintf("%d keys", len(keys)), start, 0, err)
+	return err
+}
+
+func (s *instrumentedService) DeletePrefixed(ctx context.Context, prefix string) error {
+	start := time.Now()
+	err := s.service.DeletePrefixed(ctx, prefix)
+	s.observe(ctx, "delete_prefixed", prefix, start, 0, err)
+	return err
+}
+
+func (s *instrumentedService) Exist(ctx context.Context, key string) (bool, error) {
+	start := time.Now()
+	exist, err := s.service.Exist(ctx, key)
+	s.observe(ctx, "exist", key, start, 0, err)
+	return exist, err
+}
+
+func (s *instrumentedService) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	start := time.Now()
+	info, err := Stat(ctx, s.service, key)
+	s.observe(ctx, "stat", key, start, 0, err)
+	return info, err
+}
+
+func (s *instrumentedService) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	start := time.Now()
+	err := List(ctx, s.service, prefix, fn)
+	s.observe(ctx, "list", prefix, start, 0, err)
+	return err
+}
+
+func (s *instrumentedService) URL(key string) string {
+	return s.service.URL(key)
+}
+
+func (s *instrumentedService) SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error) {
+	start := time.Now()
+	u, header, err := s.service.SignURL(ctx, key, method, expiresIn)
+	s.observe(ctx, "sign_url", key, start, 0, err)
+	return u, header, err
+}
+
+type instrumentedVariantFactory struct {
+	instrument
+	factory VariantFactory
+}
+
+// NewInstrumentedVariantFactory wraps factory to log and record metrics of Variant.Process
+// as operation "variant.process". Backend defaults to "variant".
+func NewInstrumentedVariantFactory(factory VariantFactory, options ...InstrumentOptions) VariantFactory {
+	opts := InstrumentOptions{Backend: "variant"}.merge(options)
+	return instrumentedVariantFactory{
+		instrument: instrument{
+			backend: opts.Backend,
+			logger:  opts.Logger,
+			metrics: opts.Metrics,
+		},
+		factory: factory,
+	}
+}
+
+func (f instrumentedVariantFactory) NewVariant(service Service, originPath string, options VariantOptions) Variant {
+	return instrumentedVariant{
+		Variant:    f.factory.NewVariant(service, originPath, options),
+		instrument: f.instrument,
+	}
+}
+
+var _ VariantContextProcessor = instrumentedVariant{}
+
+type instrumentedVariant struct {
+	Variant
+	instrument instrument
+}
+
+func (v instrumentedVariant) Process() error {
+	return v.ProcessContext(context.TODO())
+}
+
+func (v instrumentedVariant) ProcessContext(ctx context.Context) error {
+	start := time.Now()
+	err := ProcessVariant(ctx, v.Variant)
+	v.instrument.observe(ctx, "variant.process", v.Key(), start, 0, err)
+	return err
+}
+
+// backendName returns the name of builtin services.
+func backendName(service Service) string {
+	switch service.(type) {
+	case *s3Service:
+		return "s3"
+	case *gcsService:
+		return "gcs"
+	case *disk:
+		return "disk"
+	case *memory:
+		return "memory"
+	case NullService:
+		return "null"
+	}
+	return fmt.Sprintf("%T", service)
+}
+
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+// newCountingReader returns a reader counting bytes read from r. The returned reader
+// implements io.Seeker if r does, so wrapped services can still rewind it,
+// then the count is the distance from the start position.
+func newCountingReader(r io.Reader) (*countingReader, io.Reader) {
+	counter := &countingReader{reader: r}
+	if seeker, ok := r.(io.Seeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			return counter, countingReadSeeker{countingReader: counter, seeker: seeker, start: start}
+		}
+	}
+	return counter, counter
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+type countingReadSeeker struct {
+	*countingReader
+	seeker io.Seeker
+	start  int64
+}
+
+func (r countingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.seeker.Seek(offset, whence)
+	if err == nil {
+		r.n = pos - r.start
+	}
+	return pos, err
+}
+
+// observedReadCloser calls observe once when closed.
+type observedReadCloser struct {
+	countingReader
+	closer  io.Closer
+	observe func(n int64, err error)
+	once    sync.Once
+	readErr error
+}
+
+func (r *observedReadCloser) Read(p []byte) (int, error) {
+	n, err := r.countingReader.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) && r.readErr == nil {
+		r.readErr = err
+	}
+	return n, err
+}
+
+func (r *observedReadCloser) Close() error {
+	err := r.closer.Close()
+	r.once.Do(func() {
+		if r.readErr != nil {
+			r.observe(r.n, r.readErr)
+			return
+		}
+		r.observe(r.n, err)
+	})
+	return err
+}
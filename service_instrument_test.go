@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"expvar"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumentedService(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewDiskService(t.TempDir(), "http://localhost/disk")
+	require.NoError(t, err)
+
+	var metrics []OperationMetric
+	var logs bytes.Buffer
+	service = NewInstrumentedService(service, InstrumentOptions{
+		Logger: slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		Metrics: MetricsFunc(func(metric OperationMetric) {
+			metrics = append(metrics, metric)
+		}),
+	})
+
+	err = service.Upload(context.TODO(), "test.txt", strings.NewReader("hello world"))
+	require.NoError(t, err)
+
+	reader, err := service.Download(context.TODO(), "test.txt")
+	require.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+
+	_, err = service.Download(context.TODO(), "not-found.txt")
+	require.Error(t, err)
+
+	require.Len(t, metrics, 3)
+	require.Equal(t, OperationMetric{Operation: "upload", Backend: "disk", Duration: metrics[0].Duration, Bytes: 11, Outcome: OutcomeSuccess}, metrics[0])
+	require.Equal(t, "download", metrics[1].Operation)
+	require.Equal(t, int64(11), metrics[1].Bytes)
+	require.Equal(t, OutcomeSuccess, metrics[1].Outcome)
+	require.Equal(t, OutcomeError, metrics[2].Outcome)
+
+	require.Contains(t, logs.String(), "operation=upload backend=disk key=test.txt")
+	require.Contains(t, logs.String(), "level=ERROR msg=\"storage operation failed\" operation=download")
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	t.Parallel()
+
+	metrics := NewExpvarMetrics("storage_test")
+	metrics.Record(OperationMetric{Operation: "upload", Backend: "s3", Bytes: 10, Outcome: OutcomeSuccess})
+	metrics.Record(OperationMetric{Operation: "upload", Backend: "s3", Bytes: 5, Outcome: OutcomeError})
+
+	require.Same(t, metrics.(expvarMetric).vars, NewExpvarMetrics("storage_test").(expvarMetric).vars)
+	upload := childMap(childMap(metrics.(expvarMetric).vars, "s3"), "upload")
+	require.Equal(t, "2", upload.Get("count").String())
+	require.Equal(t, "1", upload.Get("errors").String())
+	require.Equal(t, "15", upload.Get("bytes").String())
+
+	// names published elsewhere don't panic
+	published := expvar.NewMap("storage_test_published")
+	require.Same(t, published, NewExpvarMetrics("storage_test_published").(expvarMetric).vars)
+	expvar.NewString("storage_test_string")
+	require.NotPanics(t, func() {
+		NewExpvarMetrics("storage_test_string").Record(OperationMetric{Operation: "upload", Backend: "s3"})
+	})
+}
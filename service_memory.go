@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var _ Service = (*memory)(nil)
+var _ Expirer = (*memory)(nil)
+var _ Tagger = (*memory)(nil)
+
+type memoryObject struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+	metadata    map[string]string
+	expiresAt   time.Time
+	tags        map[string]string
+}
+
+func (o memoryObject) expired() bool {
+	return !o.expiresAt.IsZero() && !o.expiresAt.After(time.Now())
+}
+
+type memory struct {
+	mu       sync.RWMutex
+	objects  map[string]memoryObject
+	endpoint string
+}
+
+// NewMemoryService creates a service storing files in memory, which is useful for caching and testing.
+func NewMemoryService(endpoint string) (Service, error) {
+	_, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memory{
+		objects:  make(map[string]memoryObject),
+		endpoint: endpoint,
+	}, nil
+}
+
+func (m *memory) Upload(ctx context.Context, key string, reader io.Reader) error {
+	contentType, reader, err := detectUploadContentType(ctx, key, reader)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = memoryObject{
+		data:        data,
+		contentType: contentType,
+		modTime:     time.Now(),
+		metadata:    metadataFromContext(ctx),
+		expiresAt:   expiresAtFromContext(ctx),
+		tags:        tagsFromContext(ctx),
+	}
+	return nil
+}
+
+func (m *memory) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	obj, ok := m.objects[key]
+	if !ok || obj.expired() {
+		return nil, notExistError("open", key)
+	}
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+func (m *memory) Copy(ctx context.Context, src string, dst string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, ok := m.objects[src]
+	if !ok || obj.expired() {
+		return notExistError("copy", src)
+	}
+	obj.modTime = time.Now()
+	if md := metadataFromContext(ctx); md != nil {
+		obj.metadata = md
+	}
+	if ct := contentTypeFromContext(ctx); ct != "" {
+		obj.contentType = ct
+	}
+	if expiresAt := expiresAtFromContext(ctx); !expiresAt.IsZero() {
+		obj.expiresAt = expiresAt
+	}
+	if tags := tagsFromContext(ctx); tags != nil {
+		obj.tags = tags
+	}
+	m.objects[dst] = obj
+	return nil
+}
+
+func (m *memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memory) DeleteBatch(ctx context.Context, keys []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		delete(m.objects, key)
+	}
+	return nil
+}
+
+func (m *memory) DeletePrefixed(ctx context.Context, prefix string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key := range m.objects {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.objects, key)
+		}
+	}
+	return nil
+}
+
+func (m *memory) Exist(ctx context.Context, key string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	obj, ok := m.objects[key]
+	return ok && !obj.expired(), nil
+}
+
+func (m *memory) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	obj, ok := m.objects[key]
+	if !ok || obj.expired() {
+		return ObjectInfo{}, notExistError("stat", key)
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         int64(len(obj.data)),
+		ContentType:  obj.contentType,
+		LastModified: obj.modTime,
+		Metadata:     obj.metadata,
+		ExpiresAt:    obj.expiresAt,
+	}, nil
+}
+
+func (m *memory) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	m.mu.RLock()
+	var objects []ObjectInfo
+	for key, obj := range m.objects {
+		if strings.HasPrefix(key, prefix) && !obj.expired() {
+			objects = append(objects, ObjectInfo{
+				Key:          key,
+				Size:         int64(len(obj.data)),
+				ContentType:  obj.contentType,
+				LastModified: obj.modTime,
+				Metadata:     obj.metadata,
+				ExpiresAt:    obj.expiresAt,
+			})
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	for _, obj := range objects {
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteExpired deletes objects expired by WithTTL.
+func (m *memory) DeleteExpired(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+	for key, obj := range m.objects {
+		if obj.expired() {
+			delete(m.objects, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *memory) GetTags(ctx context.Context, key string) (map[string]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	obj, ok := m.objects[key]
+	if !ok || obj.expired() {
+		return nil, notExistError("get tags", key)
+	}
+	return copyMetadata(obj.tags), nil
+}
+
+func (m *memory) SetTags(ctx context.Context, key string, tags map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	obj, ok := m.objects[key]
+	if !ok || obj.expired() {
+		return notExistError("set tags", key)
+	}
+	obj.tags = copyMetadata(tags)
+	m.objects[key] = obj
+	return nil
+}
+
+func (m *memory) DeleteTags(ctx context.Context, key string) error {
+	return m.SetTags(ctx, key, nil)
+}
+
+func (m *memory) URL(key string) string {
+	return URL(m.endpoint, key)
+}
+
+func (m *memory) SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error) {
+	return "", nil, ErrNotSupported
+}
+
+// notExistError returns an error matching fs.ErrNotExist like the disk service does.
+func notExistError(op string, key string) error {
+	return &fs.PathError{Op: op, Path: key, Err: fs.ErrNotExist}
+}
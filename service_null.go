@@ -2,7 +2,6 @@ package storage
 
 import (
 	"context"
-	"errors"
 	"io"
 	"net/http"
 	"time"
@@ -44,10 +43,18 @@ func (NullService) Exist(ctx context.Context, key string) (bool, error) {
 	return false, nil
 }
 
+func (NullService) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	return ObjectInfo{}, ErrNotSupported
+}
+
+func (NullService) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	return nil
+}
+
 func (NullService) URL(key string) string {
 	return ""
 }
 
 func (NullService) SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error) {
-	return "", nil, errors.New("not supported")
+	return "", nil, ErrNotSupported
 }
@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Operation is an operation checked by the service created by NewPolicyService.
+type Operation string
+
+const (
+	OpUpload         Operation = "upload"
+	OpDownload       Operation = "download"
+	OpDelete         Operation = "delete"
+	OpDeletePrefixed Operation = "delete_prefixed"
+	OpExist          Operation = "exist"
+	OpStat           Operation = "stat"
+	OpList           Operation = "list"
+	OpURL            Operation = "url"
+	OpSignURL        Operation = "sign_url"
+)
+
+// ReadOperations are operations not modifying objects.
+var ReadOperations = []Operation{OpDownload, OpExist, OpStat, OpList, OpURL, OpSignURL}
+
+// PolicyRule allows or denies operations on keys matching Pattern.
+type PolicyRule struct {
+	// Operations the rule applies to. Empty means all operations.
+	Operations []Operation
+	// Pattern is matched against keys by path.Match, such as "avatars/*.jpg".
+	// A pattern ending with "**" matches all keys starting with the rest, such as "uploads/**".
+	// Empty pattern matches all keys.
+	// OpDeletePrefixed and OpList are checked against all keys under the prefix, see Policy.AllowedPrefix.
+	Pattern string
+	Allow   bool
+}
+
+// Policy is a list of rules. The first rule matching an operation and key decides,
+// the operation is denied if no rule matches unless DefaultAllow is set.
+// Absolute keys and keys with ".." segments are always denied, so "uploads/../private/a.txt" doesn't match "uploads/**".
+type Policy struct {
+	Rules        []PolicyRule
+	DefaultAllow bool
+}
+
+// Allowed reports whether op on key is allowed.
+func (p Policy) Allowed(op Operation, key string) bool {
+	if validateKey(key) != nil {
+		return false
+	}
+	for _, rule := range p.Rules {
+		if rule.matches(op, key) {
+			return rule.Allow
+		}
+	}
+	return p.DefaultAllow
+}
+
+// AllowedPrefix reports whether op on all keys starting with prefix is allowed. It's denied if a denying rule
+// may match a key under prefix before an allowing rule matches all of them, so "uploads/**" doesn't allow
+// deleting "uploads/" if an earlier rule denies "uploads/private/**". Patterns of path.Match never match
+// all keys under a prefix, since "*" doesn't match "/".
+func (p Policy) AllowedPrefix(op Operation, prefix string) bool {
+	if validateKey(prefix) != nil {
+		return false
+	}
+	for _, rule := range p.Rules {
+		if !rule.appliesTo(op) || !rule.mayMatchUnder(prefix) {
+			continue
+		}
+		if !rule.Allow {
+			return false
+		}
+		if rule.matchesUnder(prefix) {
+			return true
+		}
+	}
+	return p.DefaultAllow
+}
+
+func (r PolicyRule) appliesTo(op Operation) bool {
+	if len(r.Operations) == 0 {
+		return true
+	}
+	for _, o := range r.Operations {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesUnder reports whether r matches all keys starting with prefix.
+func (r PolicyRule) matchesUnder(prefix string) bool {
+	if r.Pattern == "" {
+		return true
+	}
+	if p, ok := strings.CutSuffix(r.Pattern, "**"); ok {
+		return strings.HasPrefix(prefix, p)
+	}
+	return false
+}
+
+// mayMatchUnder reports whether r may match a key starting with prefix. It may report true for patterns
+// not matching any of them, which denies rather than allows.
+func (r PolicyRule) mayMatchUnder(prefix string) bool {
+	if r.Pattern == "" {
+		return true
+	}
+	if p, ok := strings.CutSuffix(r.Pattern, "**"); ok {
+		return strings.HasPrefix(prefix, p) || strings.HasPrefix(p, prefix)
+	}
+
+	// complete segments of prefix must match segments of the pattern, and the partial last segment
+	// must be a possible start of the next one
+	patterns := strings.Split(r.Pattern, "/")
+	segments := strings.Split(prefix, "/")
+	partial := segments[len(segments)-1]
+	segments = segments[:len(segments)-1]
+	if len(segments) >= len(patterns) {
+		return false
+	}
+	for i, segment := range segments {
+		if matched, err := path.Match(patterns[i], segment); err != nil || !matched {
+			return false
+		}
+	}
+	next := patterns[len(segments)]
+	literal := next
+	if i := strings.IndexAny(next, `*?[\`); i >= 0 {
+		literal = next[:i]
+	}
+	return strings.HasPrefix(literal, partial) || strings.HasPrefix(partial, literal)
+}
+
+func (r PolicyRule) matches(op Operation, key string) bool {
+	if !r.appliesTo(op) {
+		return false
+	}
+
+	if r.Pattern == "" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(r.Pattern, "**"); ok {
+		return strings.HasPrefix(key, prefix)
+	}
+	matched, err := path.Match(r.Pattern, key)
+	return err == nil && matched
+}
+
+// PermissionError is returned for operations denied by a policy. It matches fs.ErrPermission.
+type PermissionError struct {
+	Operation Operation
+	Key       string
+}
+
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("permission denied: %s %q", e.Operation, e.Key)
+}
+
+func (e *PermissionError) Is(target error) bool {
+	return target == fs.ErrPermission
+}
+
+var _ Service = (*policyService)(nil)
+
+type policyService struct {
+	service Service
+	policy  Policy
+}
+
+// NewPolicyService wraps service to check every operation against policy.
+// Denied operations return *PermissionError. Copy needs OpDownload on src and OpUpload on dst,
+// DeleteBatch needs OpDelete on every key. SignURL needs OpSignURL and the operation of the method,
+// such as OpUpload for "PUT".
+func NewPolicyService(service Service, policy Policy) Service {
+	return &policyService{
+		service: service,
+		policy:  policy,
+	}
+}
+
+// NewReadOnlyService wraps service to deny all operations modifying objects.
+func NewReadOnlyService(service Service) Service {
+	return NewPolicyService(service, Policy{
+		Rules: []PolicyRule{
+			{Operations: ReadOperations, Allow: true},
+		},
+	})
+}
+
+func (s *policyService) check(op Operation, key string) error {
+	if !s.policy.Allowed(op, key) {
+		return &PermissionError{Operation: op, Key: key}
+	}
+	return nil
+}
+
+func (s *policyService) checkPrefix(op Operation, prefix string) error {
+	if !s.policy.AllowedPrefix(op, prefix) {
+		return &PermissionError{Operation: op, Key: prefix}
+	}
+	return nil
+}
+
+func (s *policyService) Upload(ctx context.Context, key string, reader io.Reader) error {
+	if err := s.check(OpUpload, key); err != nil {
+		return err
+	}
+	return s.service.Upload(ctx, key, reader)
+}
+
+func (s *policyService) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := s.check(OpDownload, key); err != nil {
+		return nil, err
+	}
+	return s.service.Download(ctx, key)
+}
+
+func (s *policyService) Copy(ctx context.Context, src string, dst string) error {
+	if err := s.check(OpDownload, src); err != nil {
+		return err
+	}
+	if err := s.check(OpUpload, dst); err != nil {
+		return err
+	}
+	return s.service.Copy(ctx, src, dst)
+}
+
+func (s *policyService) Delete(ctx context.Context, key string) error {
+	if err := s.check(OpDelete, key); err != nil {
+		return err
+	}
+	return s.service.Delete(ctx, key)
+}
+
+func (s *policyService) DeleteBatch(ctx context.Context, keys []string) error {
+	for _, key := range keys {
+		if err := s.check(OpDelete, key); err != nil {
+			return err
+		}
+	}
+	return s.service.DeleteBatch(ctx, keys)
+}
+
+func (s *policyService) DeletePrefixed(ctx context.Context, prefix string) error {
+	if err := s.checkPrefix(OpDeletePrefixed, prefix); err != nil {
+		return err
+	}
+	return s.service.DeletePrefixed(ctx, prefix)
+}
+
+func (s *policyService) Exist(ctx context.Context, key string) (bool, error) {
+	if err := s.check(OpExist, key); err != nil {
+		return false, err
+	}
+	return s.service.Exist(ctx, key)
+}
+
+func (s *policyService) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	if err := s.check(OpStat, key); err != nil {
+		return ObjectInfo{}, err
+	}
+	return Stat(ctx, s.service, key)
+}
+
+func (s *policyService) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	if err := s.checkPrefix(OpList, prefix); err != nil {
+		return err
+	}
+	return List(ctx, s.service, prefix, fn)
+}
+
+// URL returns "" if denied.
+func (s *policyService) URL(key string) string {
+	if err := s.check(OpURL, key); err != nil {
+		return ""
+	}
+	return s.service.URL(key)
+}
+
+func (s *policyService) SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error) {
+	if err := s.check(OpSignURL, key); err != nil {
+		return "", nil, err
+	}
+
+	var op Operation
+	switch method {
+	case http.MethodGet:
+		op = OpDownload
+	case http.MethodHead:
+		op = OpExist
+	case http.MethodPut:
+		op = OpUpload
+	case http.MethodDelete:
+		op = OpDelete
+	}
+	if op != "" {
+		if err := s.check(op, key); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return s.service.SignURL(ctx, key, method, expiresIn)
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyService(t *testing.T) {
+	t.Parallel()
+
+	backend, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	require.NoError(t, backend.Upload(context.TODO(), "public/a.txt", strings.NewReader("a")))
+
+	t.Run("read only", func(t *testing.T) {
+		service := NewReadOnlyService(backend)
+
+		exist, err := service.Exist(context.TODO(), "public/a.txt")
+		require.NoError(t, err)
+		require.True(t, exist)
+		require.NotEmpty(t, service.URL("public/a.txt"))
+
+		err = service.Upload(context.TODO(), "public/b.txt", strings.NewReader("b"))
+		var permErr *PermissionError
+		require.ErrorAs(t, err, &permErr)
+		require.Equal(t, OpUpload, permErr.Operation)
+		require.ErrorIs(t, err, fs.ErrPermission)
+
+		require.ErrorIs(t, service.Delete(context.TODO(), "public/a.txt"), fs.ErrPermission)
+		require.ErrorIs(t, service.Copy(context.TODO(), "public/a.txt", "public/c.txt"), fs.ErrPermission)
+		_, _, err = service.SignURL(context.TODO(), "public/a.txt", http.MethodPut, 0)
+		require.ErrorIs(t, err, fs.ErrPermission)
+	})
+
+	t.Run("write under prefixes", func(t *testing.T) {
+		service := NewPolicyService(backend, Policy{
+			Rules: []PolicyRule{
+				{Operations: []Operation{OpUpload, OpDelete}, Pattern: "uploads/private/**", Allow: false},
+				{Operations: []Operation{OpUpload, OpDelete}, Pattern: "uploads/**", Allow: true},
+				{Operations: []Operation{OpUpload}, Pattern: "avatars/*.jpg", Allow: true},
+				{Operations: ReadOperations, Allow: true},
+			},
+		})
+
+		require.NoError(t, service.Upload(context.TODO(), "uploads/2026/a.txt", strings.NewReader("a")))
+		require.NoError(t, service.Upload(context.TODO(), "avatars/1.jpg", strings.NewReader("a")))
+		require.ErrorIs(t, service.Upload(context.TODO(), "avatars/1/2.jpg", strings.NewReader("a")), fs.ErrPermission)
+		require.ErrorIs(t, service.Upload(context.TODO(), "uploads/private/a.txt", strings.NewReader("a")), fs.ErrPermission)
+		require.ErrorIs(t, service.DeleteBatch(context.TODO(), []string{"uploads/2026/a.txt", "public/a.txt"}), fs.ErrPermission)
+		require.ErrorIs(t, service.DeletePrefixed(context.TODO(), "uploads/"), fs.ErrPermission)
+		require.NoError(t, service.Delete(context.TODO(), "uploads/2026/a.txt"))
+
+		for _, key := range []string{"uploads/../private/a.txt", "uploads/../../etc/passwd", "/uploads/a.txt"} {
+			require.ErrorIs(t, service.Upload(context.TODO(), key, strings.NewReader("a")), fs.ErrPermission, key)
+		}
+		_, err := service.Download(context.TODO(), "public/../uploads/private/a.txt")
+		require.ErrorIs(t, err, fs.ErrPermission)
+	})
+	t.Run("prefixes", func(t *testing.T) {
+		service := NewPolicyService(backend, Policy{
+			Rules: []PolicyRule{
+				{Operations: []Operation{OpDeletePrefixed, OpList}, Pattern: "uploads/private/**", Allow: false},
+				{Operations: []Operation{OpDeletePrefixed, OpList}, Pattern: "uploads/**", Allow: true},
+				{Operations: []Operation{OpDeletePrefixed, OpList}, Pattern: "avatars/*", Allow: true},
+			},
+		})
+		list := func(prefix string) error {
+			return List(context.TODO(), service, prefix, func(obj ObjectInfo) error { return nil })
+		}
+
+		// the deny rule matches keys under the prefix
+		require.ErrorIs(t, service.DeletePrefixed(context.TODO(), "uploads/"), fs.ErrPermission)
+		require.ErrorIs(t, list("uploads/"), fs.ErrPermission)
+		require.ErrorIs(t, list("uploads/priv"), fs.ErrPermission)
+		require.NoError(t, service.DeletePrefixed(context.TODO(), "uploads/2026/"))
+		require.NoError(t, list("uploads/2026/"))
+		require.NoError(t, list("uploads/public"))
+
+		// "*" doesn't match nested keys, so it doesn't allow their prefix
+		require.ErrorIs(t, service.DeletePrefixed(context.TODO(), "avatars/"), fs.ErrPermission)
+		require.ErrorIs(t, list("avatars/1"), fs.ErrPermission)
+	})
+}
+
+func TestPolicy_AllowedPrefix(t *testing.T) {
+	t.Parallel()
+
+	policy := Policy{
+		Rules: []PolicyRule{
+			{Pattern: "docs/*/secret.txt", Allow: false},
+			{Pattern: "tmp/**", Allow: true},
+		},
+		DefaultAllow: true,
+	}
+	for prefix, want := range map[string]bool{
+		"":               false,
+		"docs/":          false,
+		"docs/a/":        false,
+		"docs/a/sec":     false,
+		"docs/a/public/": true,
+		"docs/a/b/":      true,
+		"images/":        true,
+		"tmp/":           true,
+		"../":            false,
+	} {
+		require.Equal(t, want, policy.AllowedPrefix(OpList, prefix), prefix)
+	}
+}
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrInvalidKey is returned for keys escaping the prefix of the service created by NewPrefixedService.
+var ErrInvalidKey = errors.New("invalid key")
+
+var _ Service = (*prefixedService)(nil)
+
+type prefixedService struct {
+	service Service
+	prefix  string
+}
+
+// NewPrefixedService returns a service scoping all operations under prefix of service, such as "tenants/42/",
+// so each tenant gets an isolated view of a shared backend.
+//
+// A "/" is appended to prefix if missing, so "tenants/4" doesn't share keys with "tenants/42", and empty prefix
+// is rejected. Absolute keys and keys with ".." segments are rejected with ErrInvalidKey, URL returns "" for them.
+func NewPrefixedService(service Service, prefix string) (Service, error) {
+	if prefix == "" {
+		return nil, fmt.Errorf("%w: empty prefix", ErrInvalidKey)
+	}
+	if err := validateKey(prefix); err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	return &prefixedService{
+		service: service,
+		prefix:  prefix,
+	}, nil
+}
+
+func (s *prefixedService) Upload(ctx context.Context, key string, reader io.Reader) error {
+	k, err := s.scope(key)
+	if err != nil {
+		return err
+	}
+	return s.service.Upload(ctx, k, reader)
+}
+
+func (s *prefixedService) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	k, err := s.scope(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.service.Download(ctx, k)
+}
+
+func (s *prefixedService) Copy(ctx context.Context, src string, dst string) error {
+	srcKey, err := s.scope(src)
+	if err != nil {
+		return err
+	}
+	dstKey, err := s.scope(dst)
+	if err != nil {
+		return err
+	}
+	return s.service.Copy(ctx, srcKey, dstKey)
+}
+
+func (s *prefixedService) Delete(ctx context.Context, key string) error {
+	k, err := s.scope(key)
+	if err != nil {
+		return err
+	}
+	return s.service.Delete(ctx, k)
+}
+
+func (s *prefixedService) DeleteBatch(ctx context.Context, keys []string) error {
+	scoped := make([]string, len(keys))
+	for i, key := range keys {
+		k, err := s.scope(key)
+		if err != nil {
+			return err
+		}
+		scoped[i] = k
+	}
+
+	err := s.service.DeleteBatch(ctx, scoped)
+	var batchErr *DeleteBatchError
+	if errors.As(err, &batchErr) {
+		failures := make([]DeleteError, len(batchErr.Errors))
+		for i, e := range batchErr.Errors {
+			e.Key = strings.TrimPrefix(e.Key, s.prefix)
+			failures[i] = e
+		}
+		return &DeleteBatchError{Errors: failures}
+	}
+	return err
+}
+
+func (s *prefixedService) DeletePrefixed(ctx context.Context, prefix string) error {
+	p, err := s.scopePrefix(prefix)
+	if err != nil {
+		return err
+	}
+	return s.service.DeletePrefixed(ctx, p)
+}
+
+func (s *prefixedService) Exist(ctx context.Context, key string) (bool, error) {
+	k, err := s.scope(key)
+	if err != nil {
+		return false, err
+	}
+	return s.service.Exist(ctx, k)
+}
+
+func (s *prefixedService) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	k, err := s.scope(key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info, err := Stat(ctx, s.service, k)
+	info.Key = key
+	return info, err
+}
+
+// List lists objects under prefix of this service. Keys are relative to the prefix of this service.
+func (s *prefixedService) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	p, err := s.scopePrefix(prefix)
+	if err != nil {
+		return err
+	}
+	return List(ctx, s.service, p, func(obj ObjectInfo) error {
+		obj.Key = strings.TrimPrefix(obj.Key, s.prefix)
+		return fn(obj)
+	})
+}
+
+func (s *prefixedService) URL(key string) string {
+	k, err := s.scope(key)
+	if err != nil {
+		return ""
+	}
+	return s.service.URL(k)
+}
+
+func (s *prefixedService) SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error) {
+	k, err := s.scope(key)
+	if err != nil {
+		return "", nil, err
+	}
+	return s.service.SignURL(ctx, k, method, expiresIn)
+}
+
+func (s *prefixedService) scope(key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return s.prefix + key, nil
+}
+
+// scopePrefix is like scope but allows empty prefix, which means all objects of this service.
+func (s *prefixedService) scopePrefix(prefix string) (string, error) {
+	if err := validateKey(prefix); err != nil {
+		return "", err
+	}
+	return s.prefix + prefix, nil
+}
+
+// validateKey rejects keys which may escape a prefix.
+func validateKey(key string) error {
+	if strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+	return nil
+}
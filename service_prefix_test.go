@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixedService(t *testing.T) {
+	t.Parallel()
+
+	backend, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	tenant1, err := NewPrefixedService(backend, "tenants/1/")
+	require.NoError(t, err)
+	tenant2, err := NewPrefixedService(backend, "tenants/2/")
+	require.NoError(t, err)
+
+	require.NoError(t, tenant1.Upload(context.TODO(), "a.txt", strings.NewReader("a")))
+	require.NoError(t, tenant1.Upload(context.TODO(), "docs/b.txt", strings.NewReader("b")))
+	require.NoError(t, tenant2.Upload(context.TODO(), "a.txt", strings.NewReader("a")))
+
+	exist, err := backend.Exist(context.TODO(), "tenants/1/docs/b.txt")
+	require.NoError(t, err)
+	require.True(t, exist)
+	require.Equal(t, "http://localhost/memory/tenants/1/a.txt", tenant1.URL("a.txt"))
+
+	var keys []string
+	err = List(context.TODO(), tenant1, "", func(obj ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.txt", "docs/b.txt"}, keys)
+
+	info, err := Stat(context.TODO(), tenant1, "docs/b.txt")
+	require.NoError(t, err)
+	require.Equal(t, "docs/b.txt", info.Key)
+
+	for _, key := range []string{"../2/a.txt", "docs/../../2/a.txt", "/etc/passwd", "", "..\\2\\a.txt"} {
+		_, err := tenant1.Download(context.TODO(), key)
+		require.ErrorIs(t, err, ErrInvalidKey, key)
+		require.Empty(t, tenant1.URL(key))
+	}
+	require.ErrorIs(t, tenant1.DeletePrefixed(context.TODO(), ".."), ErrInvalidKey)
+
+	require.NoError(t, tenant1.DeletePrefixed(context.TODO(), ""))
+	exist, err = tenant1.Exist(context.TODO(), "a.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+	exist, err = tenant2.Exist(context.TODO(), "a.txt")
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	_, err = NewPrefixedService(backend, "")
+	require.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestPrefixedService_separator(t *testing.T) {
+	t.Parallel()
+
+	backend, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	tenant4, err := NewPrefixedService(backend, "tenants/4")
+	require.NoError(t, err)
+	tenant42, err := NewPrefixedService(backend, "tenants/42")
+	require.NoError(t, err)
+
+	require.NoError(t, tenant42.Upload(context.TODO(), "secret", strings.NewReader("secret")))
+	exist, err := backend.Exist(context.TODO(), "tenants/42/secret")
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	exist, err = tenant4.Exist(context.TODO(), "2/secret")
+	require.NoError(t, err)
+	require.False(t, exist)
+
+	var keys []string
+	err = List(context.TODO(), tenant4, "", func(obj ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Empty(t, keys)
+
+	require.NoError(t, tenant4.DeletePrefixed(context.TODO(), ""))
+	exist, err = tenant42.Exist(context.TODO(), "secret")
+	require.NoError(t, err)
+	require.True(t, exist)
+}
@@ -0,0 +1,395 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// QuotaExceededError is returned by uploads and copies exceeding the quota of a prefix.
+type QuotaExceededError struct {
+	Prefix string
+	Quota  Quota
+	// Usage is the usage before the rejected operation.
+	Usage Usage
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded for %q: %d/%d bytes, %d/%d objects",
+		e.Prefix, e.Usage.Bytes, e.Quota.MaxBytes, e.Usage.Objects, e.Quota.MaxObjects)
+}
+
+// StaticQuotas returns a QuotaOptions.QuotaFor func selecting the quota by the longest matching prefix.
+func StaticQuotas(quotas map[string]Quota) func(key string) (string, Quota, bool) {
+	prefixes := make([]string, 0, len(quotas))
+	for prefix := range quotas {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(prefixes[i]) > len(prefixes[j])
+	})
+
+	return func(key string) (string, Quota, bool) {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				return prefix, quotas[prefix], true
+			}
+		}
+		return "", Quota{}, false
+	}
+}
+
+// QuotaOptions configures the service created by NewQuotaService.
+type QuotaOptions struct {
+	// QuotaFor returns the prefix and quota of key, ok is false if key has no quota.
+	// For example, return "users/42/" for "users/42/avatar.jpg". See StaticQuotas.
+	QuotaFor func(key string) (prefix string, quota Quota, ok bool)
+	// Store persists usage. Default is NewMemoryUsageStore().
+	Store UsageStore
+}
+
+// QuotaService is a Service enforcing quotas per prefix.
+type QuotaService interface {
+	Service
+	// Usage returns the tracked usage of prefix.
+	Usage(ctx context.Context, prefix string) (Usage, error)
+	// Recompute scans objects under prefix in the backend and replaces the tracked usage.
+	Recompute(ctx context.Context, prefix string) (Usage, error)
+}
+
+var _ QuotaService = (*quotaService)(nil)
+
+type quotaService struct {
+	service  Service
+	quotaFor func(key string) (string, Quota, bool)
+	store    UsageStore
+}
+
+// NewQuotaService wraps service to track bytes and objects per prefix and reject uploads exceeding quotas.
+//
+// service must implement Stater to account overwritten and deleted objects, and Lister for DeletePrefixed and Recompute.
+// Usage is checked before and tracked after each operation, so concurrent uploads to the same prefix may exceed
+// the quota slightly.
+func NewQuotaService(service Service, options QuotaOptions) QuotaService {
+	if options.QuotaFor == nil {
+		options.QuotaFor = StaticQuotas(nil)
+	}
+	if options.Store == nil {
+		options.Store = NewMemoryUsageStore()
+	}
+
+	return &quotaService{
+		service:  service,
+		quotaFor: options.QuotaFor,
+		store:    options.Store,
+	}
+}
+
+// Upload rejects files exceeding the quota before uploading if the size is known, such as *os.File,
+// otherwise while streaming, and the partially uploaded file is deleted. Streams overwriting existing objects
+// are uploaded to a temporary key and copied into place, so rejected ones don't truncate the existing object.
+func (s *quotaService) Upload(ctx context.Context, key string, reader io.Reader) error {
+	prefix, quota, ok := s.quotaFor(key)
+	if !ok {
+		return s.service.Upload(ctx, key, reader)
+	}
+
+	usage, err := s.store.Get(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	old, exist, err := s.sizeOf(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	// usage without the overwritten object
+	base := Usage{Bytes: usage.Bytes - old}
+	base.Objects = usage.Objects
+	if exist {
+		base.Objects--
+	}
+	exceeded := &QuotaExceededError{Prefix: prefix, Quota: quota, Usage: usage}
+	if quota.MaxObjects > 0 && base.Objects+1 > quota.MaxObjects {
+		return exceeded
+	}
+
+	streaming := false
+	if quota.MaxBytes > 0 {
+		remaining := quota.MaxBytes - base.Bytes
+		size, ok := readerSize(reader)
+		if ok && size > remaining {
+			return exceeded
+		}
+		streaming = !ok
+		reader = &limitReader{reader: reader, remaining: remaining, err: exceeded}
+	}
+
+	counter, reader := newCountingReader(reader)
+	if streaming && exist {
+		err = uploadReplacing(ctx, s.service, key, reader)
+	} else {
+		err = s.service.Upload(ctx, key, reader)
+	}
+	if err != nil {
+		var quotaErr *QuotaExceededError
+		if errors.As(err, &quotaErr) && !exist {
+			_ = s.service.Delete(context.WithoutCancel(ctx), key)
+		}
+		return err
+	}
+
+	delta := Usage{Bytes: counter.n - old}
+	if !exist {
+		delta.Objects = 1
+	}
+	return s.store.Add(ctx, prefix, delta)
+}
+
+func (s *quotaService) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.service.Download(ctx, key)
+}
+
+func (s *quotaService) Copy(ctx context.Context, src string, dst string) error {
+	prefix, quota, ok := s.quotaFor(dst)
+	if !ok {
+		return s.service.Copy(ctx, src, dst)
+	}
+
+	size, _, err := s.sizeOf(ctx, src)
+	if err != nil {
+		return err
+	}
+	old, exist, err := s.sizeOf(ctx, dst)
+	if err != nil {
+		return err
+	}
+	delta := Usage{Bytes: size - old}
+	if !exist {
+		delta.Objects = 1
+	}
+
+	usage, err := s.store.Get(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	if quota.MaxBytes > 0 && usage.Bytes+delta.Bytes > quota.MaxBytes ||
+		quota.MaxObjects > 0 && usage.Objects+delta.Objects > quota.MaxObjects {
+		return &QuotaExceededError{Prefix: prefix, Quota: quota, Usage: usage}
+	}
+
+	err = s.service.Copy(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+	return s.store.Add(ctx, prefix, delta)
+}
+
+func (s *quotaService) Delete(ctx context.Context, key string) error {
+	prefix, _, ok := s.quotaFor(key)
+	if !ok {
+		return s.service.Delete(ctx, key)
+	}
+
+	size, exist, err := s.sizeOf(ctx, key)
+	if err != nil {
+		return err
+	}
+	err = s.service.Delete(ctx, key)
+	if err != nil || !exist {
+		return err
+	}
+	return s.store.Add(ctx, prefix, Usage{Bytes: -size, Objects: -1})
+}
+
+func (s *quotaService) DeleteBatch(ctx context.Context, keys []string) error {
+	sizes := make(map[string]int64)
+	for _, key := range keys {
+		if _, _, ok := s.quotaFor(key); !ok {
+			continue
+		}
+		size, exist, err := s.sizeOf(ctx, key)
+		if err != nil {
+			return err
+		}
+		if exist {
+			sizes[key] = size
+		}
+	}
+
+	err := s.service.DeleteBatch(ctx, keys)
+	var batchErr *DeleteBatchError
+	if errors.As(err, &batchErr) {
+		// failed keys are still stored
+		for _, key := range batchErr.Keys() {
+			delete(sizes, key)
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if subErr := s.subtract(ctx, sizes); subErr != nil {
+		return subErr
+	}
+	return err
+}
+
+func (s *quotaService) DeletePrefixed(ctx context.Context, prefix string) error {
+	sizes := make(map[string]int64)
+	err := List(ctx, s.service, prefix, func(obj ObjectInfo) error {
+		if _, _, ok := s.quotaFor(obj.Key); ok {
+			sizes[obj.Key] = obj.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.service.DeletePrefixed(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	return s.subtract(ctx, sizes)
+}
+
+func (s *quotaService) Exist(ctx context.Context, key string) (bool, error) {
+	return s.service.Exist(ctx, key)
+}
+
+func (s *quotaService) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	return Stat(ctx, s.service, key)
+}
+
+func (s *quotaService) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	return List(ctx, s.service, prefix, fn)
+}
+
+func (s *quotaService) URL(key string) string {
+	return s.service.URL(key)
+}
+
+// SignURL refuses "PUT", because uploads by signed URLs bypass quotas.
+func (s *quotaService) SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error) {
+	if _, _, ok := s.quotaFor(key); ok && method == http.MethodPut {
+		return "", nil, ErrNotSupported
+	}
+	return s.service.SignURL(ctx, key, method, expiresIn)
+}
+
+func (s *quotaService) Usage(ctx context.Context, prefix string) (Usage, error) {
+	return s.store.Get(ctx, prefix)
+}
+
+func (s *quotaService) Recompute(ctx context.Context, prefix string) (Usage, error) {
+	var usage Usage
+	err := List(ctx, s.service, prefix, func(obj ObjectInfo) error {
+		usage.Bytes += obj.Size
+		usage.Objects++
+		return nil
+	})
+	if err != nil {
+		return Usage{}, err
+	}
+
+	return usage, s.store.Set(ctx, prefix, usage)
+}
+
+// sizeOf returns the size of key and whether it exists.
+func (s *quotaService) sizeOf(ctx context.Context, key string) (int64, bool, error) {
+	info, err := Stat(ctx, s.service, key)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return info.Size, true, nil
+}
+
+// subtract subtracts deleted objects from usage of their prefixes.
+func (s *quotaService) subtract(ctx context.Context, sizes map[string]int64) error {
+	deltas := make(map[string]Usage)
+	for key, size := range sizes {
+		prefix, _, ok := s.quotaFor(key)
+		if !ok {
+			continue
+		}
+		d := deltas[prefix]
+		d.Bytes -= size
+		d.Objects--
+		deltas[prefix] = d
+	}
+
+	for prefix, delta := range deltas {
+		if err := s.store.Add(ctx, prefix, delta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readerSize returns the remaining size of readers with known size.
+func readerSize(reader io.Reader) (int64, bool) {
+	switch r := reader.(type) {
+	case interface{ Len() int }:
+		return int64(r.Len()), true
+	case io.Seeker:
+		cur, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		end, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, false
+		}
+		if _, err := r.Seek(cur, io.SeekStart); err != nil {
+			return 0, false
+		}
+		return end - cur, true
+	}
+	return 0, false
+}
+
+// limitReader fails with err once more than remaining bytes are read.
+type limitReader struct {
+	reader    io.Reader
+	remaining int64
+	err       error
+}
+
+func (r *limitReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n, r.err
+	}
+	return n, err
+}
+
+// uploadReplacing uploads reader to a temporary key next to key and copies it into place, so existing objects
+// are kept intact if the upload fails, such as by limitReader. The temporary key keeps the name of key,
+// so the content type detected by extension is the same.
+func uploadReplacing(ctx context.Context, service Service, key string, reader io.Reader) error {
+	token, err := randomBase36(16)
+	if err != nil {
+		return err
+	}
+	tmp := path.Join(path.Dir(key), ".upload-"+token+"-"+path.Base(key))
+
+	err = service.Upload(ctx, tmp, reader)
+	if err == nil {
+		err = service.Copy(ctx, tmp, key)
+	}
+	if delErr := service.Delete(context.WithoutCancel(ctx), tmp); delErr != nil && err == nil {
+		err = delErr
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaService(t *testing.T) {
+	t.Parallel()
+
+	backend, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	service := NewQuotaService(backend, QuotaOptions{
+		QuotaFor: StaticQuotas(map[string]Quota{
+			"users/1/": {MaxBytes: 10, MaxObjects: 2},
+		}),
+	})
+	ctx := context.TODO()
+
+	require.NoError(t, service.Upload(ctx, "users/1/a.txt", strings.NewReader("12345")))
+	// overwrite is accounted by the size difference
+	require.NoError(t, service.Upload(ctx, "users/1/a.txt", strings.NewReader("123456")))
+	usage, err := service.Usage(ctx, "users/1/")
+	require.NoError(t, err)
+	require.Equal(t, Usage{Bytes: 6, Objects: 1}, usage)
+
+	// known size is rejected before uploading
+	var quotaErr *QuotaExceededError
+	err = service.Upload(ctx, "users/1/b.txt", bytes.NewReader([]byte("12345")))
+	require.ErrorAs(t, err, &quotaErr)
+	require.Equal(t, "users/1/", quotaErr.Prefix)
+
+	// unknown size is rejected while streaming and cleaned up
+	err = service.Upload(ctx, "users/1/b.txt", io.MultiReader(strings.NewReader("12345")))
+	require.ErrorAs(t, err, &quotaErr)
+	exist, err := backend.Exist(ctx, "users/1/b.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+
+	// rejected streams keep the overwritten object
+	err = service.Upload(ctx, "users/1/a.txt", io.MultiReader(strings.NewReader("12345678901")))
+	require.ErrorAs(t, err, &quotaErr)
+	reader, err := backend.Download(ctx, "users/1/a.txt")
+	require.NoError(t, err)
+	b, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, "123456", string(b))
+	usage, err = service.Usage(ctx, "users/1/")
+	require.NoError(t, err)
+	require.Equal(t, Usage{Bytes: 6, Objects: 1}, usage)
+
+	// accepted streams replace it
+	require.NoError(t, service.Upload(ctx, "users/1/a.txt", io.MultiReader(strings.NewReader("1234567"))))
+	var keys []string
+	require.NoError(t, List(ctx, backend, "users/1/", func(obj ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	}))
+	require.Equal(t, []string{"users/1/a.txt"}, keys)
+	require.NoError(t, service.Upload(ctx, "users/1/a.txt", strings.NewReader("123456")))
+
+	require.NoError(t, service.Upload(ctx, "users/1/b.txt", strings.NewReader("1234")))
+	require.ErrorAs(t, service.Upload(ctx, "users/1/c.txt", strings.NewReader("")), &quotaErr)
+	require.ErrorAs(t, service.Copy(ctx, "users/1/a.txt", "users/1/c.txt"), &quotaErr)
+
+	// keys without quota are not tracked
+	require.NoError(t, service.Upload(ctx, "public/a.txt", strings.NewReader("12345678901")))
+
+	require.NoError(t, service.Delete(ctx, "users/1/a.txt"))
+	usage, err = service.Usage(ctx, "users/1/")
+	require.NoError(t, err)
+	require.Equal(t, Usage{Bytes: 4, Objects: 1}, usage)
+
+	// objects uploaded bypassing the service are counted by Recompute
+	require.NoError(t, backend.Upload(ctx, "users/1/d.txt", strings.NewReader("12")))
+	usage, err = service.Recompute(ctx, "users/1/")
+	require.NoError(t, err)
+	require.Equal(t, Usage{Bytes: 6, Objects: 2}, usage)
+
+	require.NoError(t, service.DeletePrefixed(ctx, "users/"))
+	usage, err = service.Usage(ctx, "users/1/")
+	require.NoError(t, err)
+	require.Equal(t, Usage{}, usage)
+}
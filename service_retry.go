@@ -0,0 +1,304 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryOptions configures the service created by NewRetryService.
+type RetryOptions struct {
+	// MaxAttempts is the maximum number of attempts for each operation, including the first one. Default is 3.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. Default is 100ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between retries. Default is 5s.
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after each retry. Default is 2.
+	Multiplier float64
+	// Jitter is the fraction of the delay that is randomized, between 0 and 1. Default is 0.2.
+	Jitter float64
+	// NoJitter disables jitter for deterministic delays, overriding Jitter.
+	NoJitter bool
+	// Retryable reports whether an error should be retried. Default is IsRetryable.
+	Retryable func(err error) bool
+	// UploadBufferSize is the maximum number of bytes buffered in memory to replay
+	// an Upload whose reader is not an io.Seeker. Uploads of such readers are not retried
+	// if it is 0 (the default) or if the content is larger.
+	UploadBufferSize int64
+}
+
+var _ Service = (*retryService)(nil)
+
+type retryService struct {
+	service Service
+	options RetryOptions
+}
+
+// NewRetryService wraps service to retry failed operations with exponential backoff and jitter.
+//
+// Only the errors classified by RetryOptions.Retryable are retried. Retrying stops when ctx is done
+// or when the next delay would exceed the ctx deadline, and the last error is returned.
+// Download only retries opening the object, errors while reading are returned to the caller.
+func NewRetryService(service Service, options ...RetryOptions) Service {
+	opts := RetryOptions{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		Retryable:      IsRetryable,
+	}
+	for _, opt := range options {
+		if opt.MaxAttempts > 0 {
+			opts.MaxAttempts = opt.MaxAttempts
+		}
+		if opt.InitialBackoff > 0 {
+			opts.InitialBackoff = opt.InitialBackoff
+		}
+		if opt.MaxBackoff > 0 {
+			opts.MaxBackoff = opt.MaxBackoff
+		}
+		if opt.Multiplier >= 1 {
+			opts.Multiplier = opt.Multiplier
+		}
+		if opt.Jitter > 0 && opt.Jitter <= 1 {
+			opts.Jitter = opt.Jitter
+		}
+		if opt.NoJitter {
+			opts.NoJitter = true
+		}
+		if opt.Retryable != nil {
+			opts.Retryable = opt.Retryable
+		}
+		if opt.UploadBufferSize > 0 {
+			opts.UploadBufferSize = opt.UploadBufferSize
+		}
+	}
+
+	return &retryService{
+		service: service,
+		options: opts,
+	}
+}
+
+// IsRetryable reports whether err is a transient error of any supported backend,
+// such as throttling, 5xx responses or reset connections.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	return isRetryableS3Error(err) || isRetryableGCSError(err)
+}
+
+func (s *retryService) Upload(ctx context.Context, key string, reader io.Reader) error {
+	replay, reader, err := s.replayable(reader)
+	if err != nil {
+		return err
+	}
+	if replay == nil {
+		return s.service.Upload(ctx, key, reader)
+	}
+
+	return s.do(ctx, func() error {
+		if err := replay(); err != nil {
+			return err
+		}
+		return s.service.Upload(ctx, key, reader)
+	})
+}
+
+func (s *retryService) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	var reader io.ReadCloser
+	err := s.do(ctx, func() error {
+		var err error
+		reader, err = s.service.Download(ctx, key)
+		return err
+	})
+	return reader, err
+}
+
+func (s *retryService) Copy(ctx context.Context, src string, dst string) error {
+	return s.do(ctx, func() error {
+		return s.service.Copy(ctx, src, dst)
+	})
+}
+
+func (s *retryService) Delete(ctx context.Context, key string) error {
+	return s.do(ctx, func() error {
+		return s.service.Delete(ctx, key)
+	})
+}
+
+// DeleteBatch retries the whole batch on retryable errors. If the batch partially failed,
+// only the keys failed with retryable error codes are retried.
+func (s *retryService) DeleteBatch(ctx context.Context, keys []string) error {
+	var failures []DeleteError
+	err := s.do(ctx, func() error {
+		err := s.service.DeleteBatch(ctx, keys)
+		var batchErr *DeleteBatchError
+		if !errors.As(err, &batchErr) {
+			return err
+		}
+
+		var retry []DeleteError
+		for _, e := range batchErr.Errors {
+			if isRetryableS3ErrorCode(e.Code) {
+				retry = append(retry, e)
+			} else {
+				failures = append(failures, e)
+			}
+		}
+		if len(retry) == 0 {
+			return nil
+		}
+
+		retryErr := &DeleteBatchError{Errors: retry}
+		keys = retryErr.Keys()
+		return partialDeleteError{retryErr}
+	})
+
+	var partialErr partialDeleteError
+	if errors.As(err, &partialErr) {
+		failures = append(failures, partialErr.Errors...)
+	} else if err != nil {
+		return err
+	}
+
+	return newDeleteBatchError(failures)
+}
+
+func (s *retryService) DeletePrefixed(ctx context.Context, prefix string) error {
+	return s.do(ctx, func() error {
+		return s.service.DeletePrefixed(ctx, prefix)
+	})
+}
+
+func (s *retryService) Exist(ctx context.Context, key string) (bool, error) {
+	var exist bool
+	err := s.do(ctx, func() error {
+		var err error
+		exist, err = s.service.Exist(ctx, key)
+		return err
+	})
+	return exist, err
+}
+
+func (s *retryService) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	var info ObjectInfo
+	err := s.do(ctx, func() error {
+		var err error
+		info, err = Stat(ctx, s.service, key)
+		return err
+	})
+	return info, err
+}
+
+// List is not retried, because fn may have been called for some objects.
+func (s *retryService) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	return List(ctx, s.service, prefix, fn)
+}
+
+func (s *retryService) URL(key string) string {
+	return s.service.URL(key)
+}
+
+func (s *retryService) SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error) {
+	return s.service.SignURL(ctx, key, method, expiresIn)
+}
+
+// do calls fn until it succeeds, returns a non-retryable error or attempts are exhausted.
+func (s *retryService) do(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < s.options.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			delay := s.backoff(attempt)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+				return err
+			}
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+
+		err = fn()
+		if err == nil || !s.retryable(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (s *retryService) retryable(err error) bool {
+	var partialErr partialDeleteError
+	if errors.As(err, &partialErr) {
+		return true
+	}
+	return s.options.Retryable(err)
+}
+
+// backoff returns the delay before the given attempt.
+func (s *retryService) backoff(attempt int) time.Duration {
+	delay := float64(s.options.InitialBackoff) * math.Pow(s.options.Multiplier, float64(attempt-1))
+	if delay > float64(s.options.MaxBackoff) {
+		delay = float64(s.options.MaxBackoff)
+	}
+	if !s.options.NoJitter {
+		delay -= delay * s.options.Jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// replayable returns a function rewinding the returned reader before each attempt.
+// The function is nil if the reader can not be replayed.
+func (s *retryService) replayable(reader io.Reader) (func() error, io.Reader, error) {
+	if seeker, ok := reader.(io.Seeker); ok {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err == nil {
+			return func() error {
+				_, err := seeker.Seek(offset, io.SeekStart)
+				return err
+			}, reader, nil
+		}
+	}
+
+	if s.options.UploadBufferSize <= 0 {
+		return nil, reader, nil
+	}
+
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, reader, s.options.UploadBufferSize+1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, err
+	}
+	if n > s.options.UploadBufferSize {
+		// too large to buffer, upload without retry
+		return nil, io.MultiReader(&buf, reader), nil
+	}
+
+	buffered := bytes.NewReader(buf.Bytes())
+	return func() error {
+		_, err := buffered.Seek(0, io.SeekStart)
+		return err
+	}, buffered, nil
+}
+
+// partialDeleteError holds the keys of DeleteBatch failed with retryable error codes.
+type partialDeleteError struct {
+	*DeleteBatchError
+}
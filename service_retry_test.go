@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/require"
+)
+
+type flakyService struct {
+	NullService
+	failures int
+	err      error
+	calls    int
+	uploaded []string
+}
+
+func (s *flakyService) fail() error {
+	s.calls++
+	if s.calls <= s.failures {
+		return s.err
+	}
+	return nil
+}
+
+func (s *flakyService) Upload(ctx context.Context, key string, reader io.Reader) error {
+	b, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if err := s.fail(); err != nil {
+		return err
+	}
+	s.uploaded = append(s.uploaded, string(b))
+	return nil
+}
+
+func (s *flakyService) Exist(ctx context.Context, key string) (bool, error) {
+	if err := s.fail(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func TestRetryService(t *testing.T) {
+	t.Parallel()
+
+	slowDown := &smithy.GenericAPIError{Code: "SlowDown", Message: "Please reduce your request rate."}
+	options := RetryOptions{InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+	t.Run("retry retryable errors", func(t *testing.T) {
+		flaky := &flakyService{failures: 2, err: slowDown}
+		exist, err := NewRetryService(flaky, options).Exist(context.TODO(), "test.txt")
+		require.NoError(t, err)
+		require.True(t, exist)
+		require.Equal(t, 3, flaky.calls)
+	})
+
+	t.Run("give up after max attempts", func(t *testing.T) {
+		flaky := &flakyService{failures: 5, err: slowDown}
+		_, err := NewRetryService(flaky, options).Exist(context.TODO(), "test.txt")
+		require.ErrorIs(t, err, slowDown)
+		require.Equal(t, 3, flaky.calls)
+	})
+
+	t.Run("not retry other errors", func(t *testing.T) {
+		denied := &smithy.GenericAPIError{Code: "AccessDenied"}
+		flaky := &flakyService{failures: 1, err: denied}
+		_, err := NewRetryService(flaky, options).Exist(context.TODO(), "test.txt")
+		require.ErrorIs(t, err, denied)
+		require.Equal(t, 1, flaky.calls)
+	})
+
+	t.Run("stop before ctx deadline", func(t *testing.T) {
+		flaky := &flakyService{failures: 5, err: slowDown}
+		ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+		defer cancel()
+		_, err := NewRetryService(flaky, RetryOptions{MaxAttempts: 5, InitialBackoff: time.Second}).Exist(ctx, "test.txt")
+		require.ErrorIs(t, err, slowDown)
+		require.Equal(t, 1, flaky.calls)
+	})
+
+	t.Run("replay seekable upload", func(t *testing.T) {
+		flaky := &flakyService{failures: 1, err: slowDown}
+		err := NewRetryService(flaky, options).Upload(context.TODO(), "test.txt", bytes.NewReader([]byte("hello world")))
+		require.NoError(t, err)
+		require.Equal(t, []string{"hello world"}, flaky.uploaded)
+	})
+
+	t.Run("not replay unbuffered upload", func(t *testing.T) {
+		flaky := &flakyService{failures: 1, err: slowDown}
+		err := NewRetryService(flaky, options).Upload(context.TODO(), "test.txt", io.LimitReader(strings.NewReader("hello world"), 100))
+		require.ErrorIs(t, err, slowDown)
+		require.Equal(t, 1, flaky.calls)
+	})
+
+	t.Run("replay buffered upload", func(t *testing.T) {
+		flaky := &flakyService{failures: 1, err: slowDown}
+		opts := options
+		opts.UploadBufferSize = 1024
+		err := NewRetryService(flaky, opts).Upload(context.TODO(), "test.txt", io.LimitReader(strings.NewReader("hello world"), 100))
+		require.NoError(t, err)
+		require.Equal(t, []string{"hello world"}, flaky.uploaded)
+	})
+}
+
+func TestRetryService_backoff(t *testing.T) {
+	t.Parallel()
+
+	service := NewRetryService(nil, RetryOptions{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     300 * time.Millisecond,
+		NoJitter:       true,
+	}).(*retryService)
+	require.Equal(t, 100*time.Millisecond, service.backoff(1))
+	require.Equal(t, 200*time.Millisecond, service.backoff(2))
+	require.Equal(t, 300*time.Millisecond, service.backoff(3))
+}
+
+func TestIsRetryable(t *testing.T) {
+	t.Parallel()
+
+	require.False(t, IsRetryable(nil))
+	require.False(t, IsRetryable(errors.New("boom")))
+	require.False(t, IsRetryable(context.DeadlineExceeded))
+	require.True(t, IsRetryable(&smithy.GenericAPIError{Code: "SlowDown"}))
+	require.True(t, IsRetryable(&smithy.GenericAPIError{Code: "InternalError"}))
+	require.True(t, IsRetryable(io.ErrUnexpectedEOF))
+}
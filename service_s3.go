@@ -9,9 +9,13 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
@@ -22,8 +26,9 @@ import (
 type contextKey string
 
 const (
-	CtxS3ACL         contextKey = "s3_acl"
-	CtxS3ContentType contextKey = "s3_contentType"
+	CtxS3ACL          contextKey = "s3_acl"
+	CtxS3ContentType  contextKey = "s3_contentType"
+	CtxS3StorageClass contextKey = "s3_storageClass"
 )
 
 // WithS3PublicRead set s3 object acl to public-read for upload and copy.
@@ -37,8 +42,15 @@ func WithS3Private(ctx context.Context) context.Context {
 }
 
 // WithS3ContentType set s3 object content-type for upload and copy.
+//
+// Deprecated: use WithContentType, which applies to all services.
 func WithS3ContentType(ctx context.Context, contentType string) context.Context {
-	return context.WithValue(ctx, CtxS3ContentType, contentType)
+	return WithContentType(ctx, contentType)
+}
+
+// WithS3StorageClass set s3 object storage class for upload and copy.
+func WithS3StorageClass(ctx context.Context, storageClass types.StorageClass) context.Context {
+	return context.WithValue(ctx, CtxS3StorageClass, storageClass)
 }
 
 func s3ACLFromContext(ctx context.Context) *types.ObjectCannedACL {
@@ -55,12 +67,40 @@ func contentTypeFromContext(ctx context.Context) string {
 	return ""
 }
 
+// s3MaxDeleteObjects is the maximum number of keys accepted by a DeleteObjects request.
+const s3MaxDeleteObjects = 1000
+
 type S3Options struct {
 	// config upload or copy ACL. Default is private
 	ACL *types.ObjectCannedACL
+	// DeleteBatchConcurrency is the number of DeleteObjects requests sent in parallel
+	// when DeleteBatch has more than 1000 keys. Default is 1.
+	DeleteBatchConcurrency int
+	// StorageClass of uploaded and copied objects. Default is INTELLIGENT_TIERING.
+	StorageClass types.StorageClass
+	// Encryption is the server-side encryption of objects. Default is the encryption of the bucket.
+	Encryption S3Encryption
+
+	// Endpoint is the URL of the S3 API of S3 compatible services, such as "http://localhost:9000" for MinIO
+	// or "https://<account>.r2.cloudflarestorage.com" for Cloudflare R2. Default is resolved by aws.Config.
+	Endpoint string
+	// UsePathStyle addresses buckets by path, "https://host/bucket/key", instead of by host,
+	// "https://bucket.host/key". It's usually required by MinIO.
+	UsePathStyle bool
+	// Region overrides the region of aws.Config, such as "auto" for Cloudflare R2.
+	Region string
+	// ChecksumAlgorithm sends the checksum of uploads, such as CRC32, verified by S3.
+	// Default is none, leave it empty for services not supporting flexible checksums.
+	ChecksumAlgorithm types.ChecksumAlgorithm
+	// ValidateChecksum requests and validates the checksums of downloads, if objects have one.
+	ValidateChecksum bool
 }
 
 var _ Service = (*s3Service)(nil)
+var _ Lifecycler = (*s3Service)(nil)
+var _ Tagger = (*s3Service)(nil)
+var _ Versioner = (*s3Service)(nil)
+var _ Archiver = (*s3Service)(nil)
 
 type s3Service struct {
 	svc        *s3.Client
@@ -69,22 +109,78 @@ type s3Service struct {
 	bucket     string
 	endpoint   string
 	acl        types.ObjectCannedACL
+
+	checksumAlgorithm types.ChecksumAlgorithm
+	validateChecksum  bool
+
+	storageClass           types.StorageClass
+	encryption             S3Encryption
+	deleteBatchConcurrency int
 }
 
+// NewS3 creates a service of bucket. endpoint is the base of URLs returned by URL, such as a CDN.
+// If endpoint is empty, it's derived from the bucket, region and S3Options.Endpoint.
 func NewS3(cfg aws.Config, bucket string, endpoint string, options ...S3Options) (Service, error) {
 	_, err := url.Parse(endpoint)
 	if err != nil {
 		return nil, err
 	}
 
+	var opts S3Options
 	acl := types.ObjectCannedACLPrivate
+	deleteBatchConcurrency := 1
+	storageClass := types.StorageClassIntelligentTiering
+	var encryption S3Encryption
 	for _, opt := range options {
 		if opt.ACL != nil {
 			acl = *opt.ACL
 		}
+		if opt.DeleteBatchConcurrency > 0 {
+			deleteBatchConcurrency = opt.DeleteBatchConcurrency
+		}
+		if opt.StorageClass != "" {
+			storageClass = opt.StorageClass
+		}
+		if opt.Encryption.Type != S3EncryptionNone {
+			if err := opt.Encryption.validate(); err != nil {
+				return nil, err
+			}
+			encryption = opt.Encryption
+		}
+		if opt.Endpoint != "" {
+			opts.Endpoint = opt.Endpoint
+		}
+		if opt.UsePathStyle {
+			opts.UsePathStyle = true
+		}
+		if opt.Region != "" {
+			opts.Region = opt.Region
+		}
+		if opt.ChecksumAlgorithm != "" {
+			opts.ChecksumAlgorithm = opt.ChecksumAlgorithm
+		}
+		if opt.ValidateChecksum {
+			opts.ValidateChecksum = true
+		}
+	}
+
+	if opts.Region == "" {
+		opts.Region = cfg.Region
+	}
+	if endpoint == "" {
+		endpoint, err = s3PublicEndpoint(opts.Endpoint, bucket, opts.Region, opts.UsePathStyle)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	svc := s3.NewFromConfig(cfg)
+	svc := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.Region = opts.Region
+		o.UsePathStyle = opts.UsePathStyle
+		if opts.Endpoint != "" {
+			o.EndpointResolver = s3.EndpointResolverFromURL(opts.Endpoint)
+		}
+	})
 	return &s3Service{
 		svc:        svc,
 		uploader:   manager.NewUploader(svc),
@@ -92,46 +188,74 @@ func NewS3(cfg aws.Config, bucket string, endpoint string, options ...S3Options)
 		bucket:     bucket,
 		endpoint:   endpoint,
 		acl:        acl,
+
+		checksumAlgorithm: opts.ChecksumAlgorithm,
+		validateChecksum:  opts.ValidateChecksum,
+
+		storageClass:           storageClass,
+		encryption:             encryption,
+		deleteBatchConcurrency: deleteBatchConcurrency,
 	}, nil
 }
 
 func (s *s3Service) Upload(ctx context.Context, key string, reader io.Reader) error {
-	// detect content type from extension
-	contentType := "application/octet-stream"
-	if ct := MimeTypeByExtension(path.Ext(key)); ct != "" {
-		contentType = ct
+	if err := checkTTLSupported(ctx); err != nil {
+		return err
 	}
-	if ct := contentTypeFromContext(ctx); ct != "" {
-		contentType = ct
+
+	contentType, reader, err := detectUploadContentType(ctx, key, reader)
+	if err != nil {
+		return err
 	}
-	// TODO: detect content type from content
 
 	acl := s.acl
 	if ctxACL := s3ACLFromContext(ctx); ctxACL != nil {
 		acl = *ctxACL
 	}
 
-	_, err := s.uploader.Upload(ctx, &s3.PutObjectInput{
+	var tagging *string
+	if tags := tagsFromContext(ctx); len(tags) > 0 {
+		tagging = aws.String(encodeTags(tags))
+	}
+
+	encryption, err := s.encryptionFor(ctx)
+	if err != nil {
+		return err
+	}
+
+	input := &s3.PutObjectInput{
 		Bucket:       aws.String(s.bucket),
 		Key:          aws.String(key),
 		ACL:          acl,
 		Body:         reader,
 		ContentType:  aws.String(contentType),
-		StorageClass: types.StorageClassIntelligentTiering,
-	})
+		Metadata:     metadataFromContext(ctx),
+		Tagging:      tagging,
+		StorageClass: s.storageClassFor(ctx),
+
+		ChecksumAlgorithm: s.checksumAlgorithm,
+	}
+	encryption.applyPut(input)
+	_, err = s.uploader.Upload(ctx, input)
 	return pkgerr.WithStack(err)
 }
 
 func (s *s3Service) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	encryption, err := s.encryptionFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if s.validateChecksum {
+		input.ChecksumMode = types.ChecksumModeEnabled
+	}
+	encryption.applyGet(input)
 	var buf manager.WriteAtBuffer
-	_, err := s.downloader.Download(
-		ctx,
-		&buf,
-		&s3.GetObjectInput{
-			Bucket: aws.String(s.bucket),
-			Key:    aws.String(key),
-		},
-	)
+	_, err = s.downloader.Download(ctx, &buf, input)
 	if err != nil {
 		return nil, err
 	}
@@ -140,13 +264,8 @@ func (s *s3Service) Download(ctx context.Context, key string) (io.ReadCloser, er
 }
 
 func (s *s3Service) Copy(ctx context.Context, src string, dst string) error {
-	// detect content type from extension
-	contentType := "application/octet-stream"
-	if ct := MimeTypeByExtension(path.Ext(dst)); ct != "" {
-		contentType = ct
-	}
-	if ct := contentTypeFromContext(ctx); ct != "" {
-		contentType = ct
+	if err := checkTTLSupported(ctx); err != nil {
+		return err
 	}
 
 	acl := s.acl
@@ -154,29 +273,77 @@ func (s *s3Service) Copy(ctx context.Context, src string, dst string) error {
 		acl = *ctxACL
 	}
 
-	_, err := s.svc.CopyObject(ctx, &s3.CopyObjectInput{
+	encryption, err := s.encryptionFor(ctx)
+	if err != nil {
+		return err
+	}
+	srcEncryption, err := s.sourceEncryptionFor(ctx)
+	if err != nil {
+		return err
+	}
+
+	// metadata is replaced along with content type, keep the content type and metadata of src if not specified
+	contentType := contentTypeFromContext(ctx)
+	metadata := metadataFromContext(ctx)
+	if contentType == "" || metadata == nil {
+		info, err := s.stat(ctx, src, srcEncryption)
+		if err != nil {
+			return err
+		}
+		if contentType == "" {
+			contentType = info.ContentType
+		}
+		if metadata == nil {
+			metadata = info.Metadata
+		}
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	// tags of src are copied unless specified
+	var tagging *string
+	taggingDirective := types.TaggingDirectiveCopy
+	if tags := tagsFromContext(ctx); tags != nil {
+		tagging = aws.String(encodeTags(tags))
+		taggingDirective = types.TaggingDirectiveReplace
+	}
+
+	input := &s3.CopyObjectInput{
 		Bucket:            aws.String(s.bucket),
 		Key:               aws.String(dst),
 		ACL:               acl,
 		MetadataDirective: types.MetadataDirectiveReplace,
 		ContentType:       aws.String(contentType),
-		StorageClass:      types.StorageClassIntelligentTiering,
-		CopySource:        aws.String(fmt.Sprintf("%s/%s", s.bucket, src)),
-	})
+		Metadata:          metadata,
+		Tagging:           tagging,
+		TaggingDirective:  taggingDirective,
+		StorageClass:      s.storageClassFor(ctx),
+		CopySource:        aws.String(copySource(s.bucket, src)),
+	}
+	encryption.applyCopy(input, srcEncryption)
+	_, err = s.svc.CopyObject(ctx, input)
 	return pkgerr.WithStack(err)
 }
 
+// copySource returns the CopySource of key in bucket. S3 decodes it as a URL, so segments of key are escaped,
+// "+" too as it may be decoded as a space.
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+	}
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
 func (s *s3Service) Delete(ctx context.Context, key string) error {
 	_, err := s.svc.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
 	if err != nil {
-		var ae smithy.APIError
-		if ok := errors.As(err, &ae); ok {
-			if ae.ErrorCode() == "NoSuchKey" || ae.ErrorCode() == "NotFound" {
-				return nil
-			}
+		if isS3NotFound(err) {
+			return nil
 		}
 		return err
 	}
@@ -184,22 +351,29 @@ func (s *s3Service) Delete(ctx context.Context, key string) error {
 	return nil
 }
 
+// DeleteBatch deletes keys in chunks of 1000, which is the limit of DeleteObjects.
+// Keys failed to delete are reported by *DeleteBatchError, joined with errors of chunks failed to send.
 func (s *s3Service) DeleteBatch(ctx context.Context, keys []string) error {
-	objects := make([]types.ObjectIdentifier, len(keys))
-	for i, key := range keys {
-		objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
-	}
-	_, err := s.svc.DeleteObjects(ctx, &s3.DeleteObjectsInput{
-		Bucket: aws.String(s.bucket),
-		Delete: &types.Delete{
-			Objects: objects,
-		},
-	})
-	if err != nil {
-		return pkgerr.WithStack(err)
+	chunks := chunkStrings(keys, s3MaxDeleteObjects)
+	failures := make([][]DeleteError, len(chunks))
+	errs := make([]error, len(chunks))
+
+	sem := make(chan struct{}, s.deleteBatchConcurrency)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, chunk []string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			failures[i], errs[i] = s.deleteObjects(ctx, chunk)
+		}(i, chunk)
 	}
+	wg.Wait()
 
-	return nil
+	return errors.Join(append(errs, newDeleteBatchError(failures...))...)
 }
 
 func (s *s3Service) DeletePrefixed(ctx context.Context, prefix string) error {
@@ -208,46 +382,78 @@ func (s *s3Service) DeletePrefixed(ctx context.Context, prefix string) error {
 		Prefix: aws.String(prefix),
 	})
 
+	var failures []DeleteError
 	for p.HasMorePages() {
 		page, err := p.NextPage(ctx)
 		if err != nil {
-			return pkgerr.WithStack(err)
+			return errors.Join(pkgerr.WithStack(err), newDeleteBatchError(failures))
 		}
 
 		if len(page.Contents) == 0 {
-			return nil
+			break
 		}
 
-		keys := make([]types.ObjectIdentifier, len(page.Contents))
+		keys := make([]string, len(page.Contents))
 		for i, obj := range page.Contents {
-			keys[i] = types.ObjectIdentifier{Key: obj.Key}
+			keys[i] = aws.ToString(obj.Key)
 		}
-		_, err = s.svc.DeleteObjects(ctx, &s3.DeleteObjectsInput{
-			Bucket: aws.String(s.bucket),
-			Delete: &types.Delete{
-				Objects: keys,
-			},
-		})
+		f, err := s.deleteObjects(ctx, keys)
 		if err != nil {
-			return pkgerr.WithStack(err)
+			return errors.Join(err, newDeleteBatchError(failures))
 		}
+		failures = append(failures, f...)
 	}
 
-	return nil
+	return newDeleteBatchError(failures)
 }
 
-func (s *s3Service) Exist(ctx context.Context, key string) (bool, error) {
-	_, err := s.svc.HeadObject(ctx, &s3.HeadObjectInput{
+// deleteObjects deletes at most 1000 keys and returns the keys failed to delete.
+func (s *s3Service) deleteObjects(ctx context.Context, keys []string) ([]DeleteError, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	objects := make([]types.ObjectIdentifier, len(keys))
+	for i, key := range keys {
+		objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
+	}
+	out, err := s.svc.DeleteObjects(ctx, &s3.DeleteObjectsInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
+		Delete: &types.Delete{
+			Objects: objects,
+			Quiet:   true,
+		},
 	})
+	if err != nil {
+		return nil, pkgerr.WithStack(err)
+	}
+
+	var failures []DeleteError
+	for _, e := range out.Errors {
+		failures = append(failures, DeleteError{
+			Key:     aws.ToString(e.Key),
+			Code:    aws.ToString(e.Code),
+			Message: aws.ToString(e.Message),
+		})
+	}
+	return failures, nil
+}
 
+func (s *s3Service) Exist(ctx context.Context, key string) (bool, error) {
+	encryption, err := s.encryptionFor(ctx)
 	if err != nil {
-		var ae smithy.APIError
-		if ok := errors.As(err, &ae); ok {
-			if ae.ErrorCode() == "NoSuchKey" || ae.ErrorCode() == "NotFound" {
-				return false, nil
-			}
+		return false, err
+	}
+
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	encryption.applyHead(input)
+	_, err = s.svc.HeadObject(ctx, input)
+	if err != nil {
+		if isS3NotFound(err) {
+			return false, nil
 		}
 
 		return false, pkgerr.WithStack(err)
@@ -256,10 +462,96 @@ func (s *s3Service) Exist(ctx context.Context, key string) (bool, error) {
 	return true, nil
 }
 
+func (s *s3Service) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	encryption, err := s.encryptionFor(ctx)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return s.stat(ctx, key, encryption)
+}
+
+func (s *s3Service) stat(ctx context.Context, key string, encryption S3Encryption) (ObjectInfo, error) {
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	encryption.applyHead(input)
+	out, err := s.svc.HeadObject(ctx, input)
+	if err != nil {
+		if isS3NotFound(err) {
+			return ObjectInfo{}, notExistError("stat", key)
+		}
+		return ObjectInfo{}, pkgerr.WithStack(err)
+	}
+
+	return ObjectInfo{
+		Key:          key,
+		Size:         out.ContentLength,
+		ContentType:  aws.ToString(out.ContentType),
+		LastModified: aws.ToTime(out.LastModified),
+		Metadata:     out.Metadata,
+	}, nil
+}
+
+func (s *s3Service) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	p := s3.NewListObjectsV2Paginator(s.svc, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return pkgerr.WithStack(err)
+		}
+
+		for _, obj := range page.Contents {
+			err = fn(ObjectInfo{
+				Key:          aws.ToString(obj.Key),
+				Size:         obj.Size,
+				LastModified: aws.ToTime(obj.LastModified),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
 func (s *s3Service) URL(key string) string {
 	return URL(s.endpoint, key)
 }
 
+// s3PublicEndpoint derives the base URL of objects of bucket, addressed by host unless usePathStyle is set.
+// apiEndpoint is the endpoint of S3 compatible services, empty for AWS.
+func s3PublicEndpoint(apiEndpoint string, bucket string, region string, usePathStyle bool) (string, error) {
+	if apiEndpoint == "" {
+		host := "s3.amazonaws.com"
+		if region != "" {
+			host = "s3." + region + ".amazonaws.com"
+		}
+		apiEndpoint = "https://" + host
+	}
+
+	u, err := url.Parse(apiEndpoint)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid S3 endpoint %q", apiEndpoint)
+	}
+
+	// certificates of the endpoint don't match hosts of buckets with dots
+	if usePathStyle || (u.Scheme == "https" && strings.Contains(bucket, ".")) {
+		u.Path = path.Join("/", u.Path, bucket)
+	} else {
+		u.Host = bucket + "." + u.Host
+	}
+	return u.String(), nil
+}
+
 func (s *s3Service) SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error) {
 	presignedClient := s3.NewPresignClient(s.svc)
 	var optFns []func(*s3.PresignOptions)
@@ -267,30 +559,42 @@ func (s *s3Service) SignURL(ctx context.Context, key string, method string, expi
 		optFns = append(optFns, s3.WithPresignExpires(expiresIn))
 	}
 
+	// SSE headers are signed, clients must send them as returned
+	encryption, err := s.encryptionFor(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
 	switch method {
 	case http.MethodGet:
-		req, err := presignedClient.PresignGetObject(ctx, &s3.GetObjectInput{
+		input := &s3.GetObjectInput{
 			Bucket: aws.String(s.bucket),
 			Key:    aws.String(key),
-		}, optFns...)
+		}
+		encryption.applyGet(input)
+		req, err := presignedClient.PresignGetObject(ctx, input, optFns...)
 		if err != nil {
 			return "", nil, err
 		}
 		return req.URL, req.SignedHeader, nil
 	case http.MethodPut:
-		req, err := presignedClient.PresignPutObject(ctx, &s3.PutObjectInput{
+		input := &s3.PutObjectInput{
 			Bucket: aws.String(s.bucket),
 			Key:    aws.String(key),
-		}, optFns...)
+		}
+		encryption.applyPut(input)
+		req, err := presignedClient.PresignPutObject(ctx, input, optFns...)
 		if err != nil {
 			return "", nil, err
 		}
 		return req.URL, req.SignedHeader, nil
 	case http.MethodHead:
-		req, err := presignedClient.PresignHeadObject(ctx, &s3.HeadObjectInput{
+		input := &s3.HeadObjectInput{
 			Bucket: aws.String(s.bucket),
 			Key:    aws.String(key),
-		}, optFns...)
+		}
+		encryption.applyHead(input)
+		req, err := presignedClient.PresignHeadObject(ctx, input, optFns...)
 		if err != nil {
 			return "", nil, err
 		}
@@ -306,5 +610,456 @@ func (s *s3Service) SignURL(ctx context.Context, key string, method string, expi
 		return req.URL, req.SignedHeader, nil
 	}
 
-	return "", nil, errors.New("not supported")
+	return "", nil, ErrNotSupported
+}
+
+func (s *s3Service) GetTags(ctx context.Context, key string) (map[string]string, error) {
+	out, err := s.svc.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, notExistError("get tags", key)
+		}
+		return nil, pkgerr.WithStack(err)
+	}
+
+	if len(out.TagSet) == 0 {
+		return nil, nil
+	}
+	tags := make(map[string]string, len(out.TagSet))
+	for _, tag := range out.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return tags, nil
+}
+
+func (s *s3Service) SetTags(ctx context.Context, key string, tags map[string]string) error {
+	if len(tags) == 0 {
+		return s.DeleteTags(ctx, key)
+	}
+
+	tagSet := make([]types.Tag, 0, len(tags))
+	for k, v := range tags {
+		tagSet = append(tagSet, types.Tag{Key: aws.String(k), Value: aws.String(v)})
+	}
+	_, err := s.svc.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(s.bucket),
+		Key:     aws.String(key),
+		Tagging: &types.Tagging{TagSet: tagSet},
+	})
+	if isS3NotFound(err) {
+		return notExistError("set tags", key)
+	}
+	return pkgerr.WithStack(err)
+}
+
+func (s *s3Service) DeleteTags(ctx context.Context, key string) error {
+	_, err := s.svc.DeleteObjectTagging(ctx, &s3.DeleteObjectTaggingInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if isS3NotFound(err) {
+		return notExistError("delete tags", key)
+	}
+	return pkgerr.WithStack(err)
+}
+
+func (s *s3Service) ListVersions(ctx context.Context, key string) ([]ObjectVersion, error) {
+	var versions []ObjectVersion
+	input := &s3.ListObjectVersionsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(key),
+	}
+	for {
+		out, err := s.svc.ListObjectVersions(ctx, input)
+		if err != nil {
+			return nil, pkgerr.WithStack(err)
+		}
+
+		for _, v := range out.Versions {
+			if aws.ToString(v.Key) != key {
+				continue
+			}
+			versions = append(versions, ObjectVersion{
+				Key:          key,
+				VersionID:    aws.ToString(v.VersionId),
+				Size:         v.Size,
+				LastModified: aws.ToTime(v.LastModified),
+				IsLatest:     v.IsLatest,
+			})
+		}
+		for _, m := range out.DeleteMarkers {
+			if aws.ToString(m.Key) != key {
+				continue
+			}
+			versions = append(versions, ObjectVersion{
+				Key:          key,
+				VersionID:    aws.ToString(m.VersionId),
+				LastModified: aws.ToTime(m.LastModified),
+				IsLatest:     m.IsLatest,
+				DeleteMarker: true,
+			})
+		}
+
+		// keys sharing the prefix sort after key
+		if !out.IsTruncated || aws.ToString(out.NextKeyMarker) != key {
+			break
+		}
+		input.KeyMarker = out.NextKeyMarker
+		input.VersionIdMarker = out.NextVersionIdMarker
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].IsLatest != versions[j].IsLatest {
+			return versions[i].IsLatest
+		}
+		return versions[i].LastModified.After(versions[j].LastModified)
+	})
+	return versions, nil
+}
+
+func (s *s3Service) DownloadVersion(ctx context.Context, key string, versionID string) (io.ReadCloser, error) {
+	encryption, err := s.encryptionFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(s.bucket),
+		Key:       aws.String(key),
+		VersionId: aws.String(versionID),
+	}
+	if s.validateChecksum {
+		input.ChecksumMode = types.ChecksumModeEnabled
+	}
+	encryption.applyGet(input)
+	var buf manager.WriteAtBuffer
+	_, err = s.downloader.Download(ctx, &buf, input)
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, notExistError("download version", key)
+		}
+		return nil, pkgerr.WithStack(err)
+	}
+
+	return manager.ReadSeekCloser(bytes.NewReader(buf.Bytes())), nil
+}
+
+// CopyVersion copies a version of key to dst with its content type and metadata.
+func (s *s3Service) CopyVersion(ctx context.Context, key string, versionID string, dst string) error {
+	if err := checkTTLSupported(ctx); err != nil {
+		return err
+	}
+
+	acl := s.acl
+	if ctxACL := s3ACLFromContext(ctx); ctxACL != nil {
+		acl = *ctxACL
+	}
+
+	encryption, err := s.encryptionFor(ctx)
+	if err != nil {
+		return err
+	}
+	srcEncryption, err := s.sourceEncryptionFor(ctx)
+	if err != nil {
+		return err
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:       aws.String(s.bucket),
+		Key:          aws.String(dst),
+		ACL:          acl,
+		StorageClass: s.storageClassFor(ctx),
+		CopySource:   aws.String(copySource(s.bucket, key) + "?versionId=" + url.QueryEscape(versionID)),
+	}
+	encryption.applyCopy(input, srcEncryption)
+	_, err = s.svc.CopyObject(ctx, input)
+	if isS3NotFound(err) {
+		return notExistError("copy version", key)
+	}
+	return pkgerr.WithStack(err)
+}
+
+func (s *s3Service) DeleteVersion(ctx context.Context, key string, versionID string) error {
+	_, err := s.svc.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:    aws.String(s.bucket),
+		Key:       aws.String(key),
+		VersionId: aws.String(versionID),
+	})
+	if isS3NotFound(err) {
+		return notExistError("delete version", key)
+	}
+	return pkgerr.WithStack(err)
+}
+
+func (s *s3Service) RestoreVersion(ctx context.Context, key string, versionID string) error {
+	return s.CopyVersion(ctx, key, versionID, key)
+}
+
+func (s *s3Service) storageClassFor(ctx context.Context) types.StorageClass {
+	if v, ok := ctx.Value(CtxS3StorageClass).(types.StorageClass); ok {
+		return v
+	}
+	return s.storageClass
+}
+
+// Transition copies key in place with storageClass, keeping metadata and tags. CopyObject resets ACLs,
+// so the ACL of the context is applied, or the grants of key are read before and restored after the copy.
+// Objects larger than 5GB can't be copied by CopyObject, use lifecycle rules for them.
+func (s *s3Service) Transition(ctx context.Context, key string, storageClass string) error {
+	encryption, err := s.encryptionFor(ctx)
+	if err != nil {
+		return err
+	}
+
+	input := &s3.CopyObjectInput{
+		Bucket:            aws.String(s.bucket),
+		Key:               aws.String(key),
+		MetadataDirective: types.MetadataDirectiveCopy,
+		StorageClass:      types.StorageClass(storageClass),
+		CopySource:        aws.String(copySource(s.bucket, key)),
+	}
+	var policy *types.AccessControlPolicy
+	if acl := s3ACLFromContext(ctx); acl != nil {
+		input.ACL = *acl
+	} else if policy, err = s.objectACL(ctx, key); err != nil {
+		return err
+	}
+	encryption.applyCopy(input, encryption)
+	_, err = s.svc.CopyObject(ctx, input)
+	if isS3NotFound(err) {
+		return notExistError("transition", key)
+	}
+	if err != nil || policy == nil {
+		return pkgerr.WithStack(err)
+	}
+
+	_, err = s.svc.PutObjectAcl(ctx, &s3.PutObjectAclInput{
+		Bucket:              aws.String(s.bucket),
+		Key:                 aws.String(key),
+		AccessControlPolicy: policy,
+	})
+	return pkgerr.WithStack(err)
+}
+
+// objectACL returns the grants of key, nil if ACLs are disabled for the bucket.
+func (s *s3Service) objectACL(ctx context.Context, key string) (*types.AccessControlPolicy, error) {
+	out, err := s.svc.GetObjectAcl(ctx, &s3.GetObjectAclInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	var ae smithy.APIError
+	if errors.As(err, &ae) && ae.ErrorCode() == "AccessControlListNotSupported" {
+		return nil, nil
+	}
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, notExistError("transition", key)
+		}
+		return nil, pkgerr.WithStack(err)
+	}
+	return &types.AccessControlPolicy{Grants: out.Grants, Owner: out.Owner}, nil
+}
+
+func (s *s3Service) Restore(ctx context.Context, key string, options RestoreOptions) error {
+	days := options.Days
+	if days <= 0 {
+		days = 1
+	}
+	request := &types.RestoreRequest{Days: int32(days)}
+	if options.Tier != "" {
+		request.GlacierJobParameters = &types.GlacierJobParameters{Tier: types.Tier(options.Tier)}
+	}
+
+	_, err := s.svc.RestoreObject(ctx, &s3.RestoreObjectInput{
+		Bucket:         aws.String(s.bucket),
+		Key:            aws.String(key),
+		RestoreRequest: request,
+	})
+	var ae smithy.APIError
+	if errors.As(err, &ae) && ae.ErrorCode() == "RestoreAlreadyInProgress" {
+		return nil
+	}
+	if isS3NotFound(err) {
+		return notExistError("restore", key)
+	}
+	return pkgerr.WithStack(err)
+}
+
+func (s *s3Service) RestoreStatus(ctx context.Context, key string) (ArchiveStatus, error) {
+	encryption, err := s.encryptionFor(ctx)
+	if err != nil {
+		return ArchiveStatus{}, err
+	}
+
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	encryption.applyHead(input)
+	out, err := s.svc.HeadObject(ctx, input)
+	if err != nil {
+		if isS3NotFound(err) {
+			return ArchiveStatus{}, notExistError("stat", key)
+		}
+		return ArchiveStatus{}, pkgerr.WithStack(err)
+	}
+
+	status := parseS3Restore(aws.ToString(out.Restore))
+	status.StorageClass = string(out.StorageClass)
+	if status.StorageClass == "" {
+		status.StorageClass = string(types.StorageClassStandard)
+	}
+	switch out.StorageClass {
+	case types.StorageClassGlacier, types.StorageClassDeepArchive:
+		status.Archived = true
+	}
+	// INTELLIGENT_TIERING objects in archive tiers must be restored too
+	switch out.ArchiveStatus {
+	case types.ArchiveStatusArchiveAccess, types.ArchiveStatusDeepArchiveAccess:
+		status.Archived = true
+	}
+	return status, nil
+}
+
+// parseS3Restore parses the x-amz-restore header, such as
+// `ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`.
+func parseS3Restore(header string) ArchiveStatus {
+	var status ArchiveStatus
+	if header == "" {
+		return status
+	}
+
+	status.Ongoing = strings.Contains(header, `ongoing-request="true"`)
+	if _, rest, ok := strings.Cut(header, `expiry-date="`); ok {
+		if date, _, ok := strings.Cut(rest, `"`); ok {
+			if t, err := http.ParseTime(date); err == nil {
+				status.ExpiresAt = t
+			}
+		}
+	}
+	return status
+}
+
+// SetExpiration puts a lifecycle rule expiring objects under prefix, other rules of the bucket are kept.
+func (s *s3Service) SetExpiration(ctx context.Context, prefix string, days int) error {
+	return s.putLifecycleRule(ctx, types.LifecycleRule{
+		ID:         aws.String(s3ExpirationRuleID(prefix)),
+		Status:     types.ExpirationStatusEnabled,
+		Filter:     &types.LifecycleRuleFilterMemberPrefix{Value: prefix},
+		Expiration: &types.LifecycleExpiration{Days: int32(days)},
+	})
+}
+
+func (s *s3Service) RemoveExpiration(ctx context.Context, prefix string) error {
+	return s.deleteLifecycleRule(ctx, s3ExpirationRuleID(prefix))
+}
+
+func s3ExpirationRuleID(prefix string) string {
+	return "storage-expiration-" + prefix
+}
+
+func (s *s3Service) lifecycleRules(ctx context.Context) ([]types.LifecycleRule, error) {
+	out, err := s.svc.GetBucketLifecycleConfiguration(ctx, &s3.GetBucketLifecycleConfigurationInput{
+		Bucket: aws.String(s.bucket),
+	})
+	if err != nil {
+		var ae smithy.APIError
+		if errors.As(err, &ae) && ae.ErrorCode() == "NoSuchLifecycleConfiguration" {
+			return nil, nil
+		}
+		return nil, pkgerr.WithStack(err)
+	}
+	return out.Rules, nil
+}
+
+// putLifecycleRule adds rule to the lifecycle configuration of the bucket, replacing the rule with the same ID.
+func (s *s3Service) putLifecycleRule(ctx context.Context, rule types.LifecycleRule) error {
+	rules, err := s.lifecycleRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i, r := range rules {
+		if aws.ToString(r.ID) == aws.ToString(rule.ID) {
+			rules[i] = rule
+			replaced = true
+		}
+	}
+	if !replaced {
+		rules = append(rules, rule)
+	}
+	return s.putLifecycleRules(ctx, rules)
+}
+
+func (s *s3Service) deleteLifecycleRule(ctx context.Context, id string) error {
+	rules, err := s.lifecycleRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	kept := rules[:0]
+	for _, r := range rules {
+		if aws.ToString(r.ID) != id {
+			kept = append(kept, r)
+		}
+	}
+	if len(kept) == len(rules) {
+		return nil
+	}
+	return s.putLifecycleRules(ctx, kept)
+}
+
+func (s *s3Service) putLifecycleRules(ctx context.Context, rules []types.LifecycleRule) error {
+	if len(rules) == 0 {
+		_, err := s.svc.DeleteBucketLifecycle(ctx, &s3.DeleteBucketLifecycleInput{
+			Bucket: aws.String(s.bucket),
+		})
+		return pkgerr.WithStack(err)
+	}
+
+	_, err := s.svc.PutBucketLifecycleConfiguration(ctx, &s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(s.bucket),
+		LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: rules},
+	})
+	return pkgerr.WithStack(err)
+}
+
+func isS3NotFound(err error) bool {
+	var ae smithy.APIError
+	if ok := errors.As(err, &ae); ok {
+		switch ae.ErrorCode() {
+		case "NoSuchKey", "NoSuchVersion", "NotFound":
+			return true
+		}
+	}
+	return false
+}
+
+// isRetryableS3Error reports whether err is a throttling, timeout, 5xx or connection error of the S3 SDK.
+func isRetryableS3Error(err error) bool {
+	var ae smithy.APIError
+	if errors.As(err, &ae) && isRetryableS3ErrorCode(ae.ErrorCode()) {
+		return true
+	}
+
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
+
+// isRetryableS3ErrorCode reports whether code is an S3 error code worth retrying, such as "SlowDown".
+func isRetryableS3ErrorCode(code string) bool {
+	if _, ok := retry.DefaultRetryableErrorCodes[code]; ok {
+		return true
+	}
+	if _, ok := retry.DefaultThrottleErrorCodes[code]; ok {
+		return true
+	}
+	switch code {
+	case "InternalError", "ServiceUnavailable":
+		return true
+	}
+	return false
 }
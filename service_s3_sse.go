@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	CtxS3Encryption       contextKey = "s3_encryption"
+	CtxS3SourceEncryption contextKey = "s3_sourceEncryption"
+)
+
+// S3EncryptionType is the type of S3 server-side encryption.
+type S3EncryptionType string
+
+const (
+	// S3EncryptionNone uses the default encryption of the bucket.
+	S3EncryptionNone S3EncryptionType = ""
+	// S3EncryptionS3 encrypts with keys managed by S3 (SSE-S3).
+	S3EncryptionS3 S3EncryptionType = "SSE-S3"
+	// S3EncryptionKMS encrypts with a KMS key (SSE-KMS).
+	S3EncryptionKMS S3EncryptionType = "SSE-KMS"
+	// S3EncryptionCustomer encrypts with a key provided by the client (SSE-C).
+	// The key is required to download, stat and copy the object.
+	S3EncryptionCustomer S3EncryptionType = "SSE-C"
+)
+
+// S3Encryption configures server-side encryption of S3 objects.
+type S3Encryption struct {
+	Type S3EncryptionType
+	// KMSKeyID is the ID or ARN of the KMS key for SSE-KMS. Default is the AWS managed key of S3.
+	KMSKeyID string
+	// BucketKey enables the S3 Bucket Key for SSE-KMS, reducing requests to KMS.
+	BucketKey bool
+	// CustomerKey is the 256-bit key for SSE-C.
+	CustomerKey []byte
+}
+
+func (e S3Encryption) validate() error {
+	switch e.Type {
+	case S3EncryptionNone, S3EncryptionS3:
+	case S3EncryptionKMS:
+	case S3EncryptionCustomer:
+		if len(e.CustomerKey) != 32 {
+			return fmt.Errorf("SSE-C requires a 32 bytes key, got %d bytes", len(e.CustomerKey))
+		}
+	default:
+		return fmt.Errorf("unknown S3 encryption type %q", e.Type)
+	}
+	return nil
+}
+
+// WithS3Encryption sets server-side encryption of upload, copy, download, stat and signed URLs,
+// overriding S3Options.Encryption.
+func WithS3Encryption(ctx context.Context, encryption S3Encryption) context.Context {
+	return context.WithValue(ctx, CtxS3Encryption, encryption)
+}
+
+// WithS3SourceEncryption sets the SSE-C key of the source object of copy, such as the old key when rotating keys.
+// By default the source is read with the encryption of WithS3Encryption or S3Options.Encryption.
+func WithS3SourceEncryption(ctx context.Context, encryption S3Encryption) context.Context {
+	return context.WithValue(ctx, CtxS3SourceEncryption, encryption)
+}
+
+func (s *s3Service) encryptionFor(ctx context.Context) (S3Encryption, error) {
+	if v, ok := ctx.Value(CtxS3Encryption).(S3Encryption); ok {
+		return v, v.validate()
+	}
+	return s.encryption, nil
+}
+
+func (s *s3Service) sourceEncryptionFor(ctx context.Context) (S3Encryption, error) {
+	if v, ok := ctx.Value(CtxS3SourceEncryption).(S3Encryption); ok {
+		return v, v.validate()
+	}
+	return s.encryptionFor(ctx)
+}
+
+// s3CustomerKey returns the algorithm, base64 encoded key and MD5 headers of SSE-C, or nils for other types.
+func s3CustomerKey(e S3Encryption) (algorithm, key, keyMD5 *string) {
+	if e.Type != S3EncryptionCustomer {
+		return nil, nil, nil
+	}
+	sum := md5.Sum(e.CustomerKey)
+	return aws.String(string(types.ServerSideEncryptionAes256)),
+		aws.String(base64.StdEncoding.EncodeToString(e.CustomerKey)),
+		aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+// s3ServerSide returns the x-amz-server-side-encryption headers of SSE-S3 and SSE-KMS.
+func s3ServerSide(e S3Encryption) (sse types.ServerSideEncryption, kmsKeyID *string, bucketKey bool) {
+	switch e.Type {
+	case S3EncryptionS3:
+		return types.ServerSideEncryptionAes256, nil, false
+	case S3EncryptionKMS:
+		if e.KMSKeyID != "" {
+			kmsKeyID = aws.String(e.KMSKeyID)
+		}
+		return types.ServerSideEncryptionAwsKms, kmsKeyID, e.BucketKey
+	}
+	return "", nil, false
+}
+
+// applyPut sets encryption of uploads, the uploader applies it to multipart uploads as well.
+func (e S3Encryption) applyPut(in *s3.PutObjectInput) {
+	in.ServerSideEncryption, in.SSEKMSKeyId, in.BucketKeyEnabled = s3ServerSide(e)
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = s3CustomerKey(e)
+}
+
+func (e S3Encryption) applyCopy(in *s3.CopyObjectInput, src S3Encryption) {
+	in.ServerSideEncryption, in.SSEKMSKeyId, in.BucketKeyEnabled = s3ServerSide(e)
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = s3CustomerKey(e)
+	in.CopySourceSSECustomerAlgorithm, in.CopySourceSSECustomerKey, in.CopySourceSSECustomerKeyMD5 = s3CustomerKey(src)
+}
+
+// applyGet sets the SSE-C key, objects encrypted by SSE-S3 and SSE-KMS are decrypted transparently.
+func (e S3Encryption) applyGet(in *s3.GetObjectInput) {
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = s3CustomerKey(e)
+}
+
+func (e S3Encryption) applyHead(in *s3.HeadObjectInput) {
+	in.SSECustomerAlgorithm, in.SSECustomerKey, in.SSECustomerKeyMD5 = s3CustomerKey(e)
+}
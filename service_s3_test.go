@@ -3,27 +3,234 @@ package storage
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/bastengao/go-storage/s3test"
 	"github.com/stretchr/testify/require"
 )
 
+func newFakeS3(t *testing.T, options ...S3Options) (*s3Service, *s3test.Server) {
+	server := s3test.NewServer("bucket")
+	t.Cleanup(server.Close)
+
+	options = append(options, S3Options{Endpoint: server.URL, UsePathStyle: true})
+	service, err := NewS3(server.Config(), "bucket", "", options...)
+	require.NoError(t, err)
+	return service.(*s3Service), server
+}
+
 func TestS3Upload(t *testing.T) {
-	// TODO: use mock
-	t.Skip()
+	t.Parallel()
+
+	service, server := newFakeS3(t)
+	ctx := WithS3PublicRead(context.Background())
+	ctx = WithMetadata(ctx, map[string]string{"owner": "alice"})
+	ctx = WithTags(ctx, map[string]string{"pii": "true"})
+	err := service.Upload(ctx, "test/abc.txt", bytes.NewReader([]byte("hello world")))
+	require.NoError(t, err)
+
+	obj, ok := server.Object("bucket", "test/abc.txt")
+	require.True(t, ok)
+	require.Equal(t, "hello world", string(obj.Data))
+	require.Equal(t, "text/plain; charset=utf-8", obj.ContentType)
+	require.Equal(t, "INTELLIGENT_TIERING", obj.StorageClass)
+	require.Equal(t, map[string]string{"pii": "true"}, obj.Tags)
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithClientLogMode(aws.LogRetries|aws.LogRequest|aws.LogResponse))
+	ctx = context.Background()
+	exist, err := service.Exist(ctx, "test/abc.txt")
+	require.NoError(t, err)
+	require.True(t, exist)
+	exist, err = service.Exist(ctx, "test/none.txt")
 	require.NoError(t, err)
+	require.False(t, exist)
 
-	s3, err := NewS3(cfg, "TODO: bucket", "TODO: endpoint")
+	info, err := service.Stat(ctx, "test/abc.txt")
 	require.NoError(t, err)
+	require.Equal(t, int64(11), info.Size)
+	require.Equal(t, map[string]string{"owner": "alice"}, info.Metadata)
+	_, err = service.Stat(ctx, "test/none.txt")
+	require.ErrorIs(t, err, fs.ErrNotExist)
 
-	ctx := WithS3PublicRead(context.TODO())
-	err = s3.Upload(ctx, "test/abc.txt", bytes.NewReader([]byte("hello world")))
+	reader, err := service.Download(ctx, "test/abc.txt")
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(data))
+
+	// copy keeps content type, metadata and tags of src
+	err = service.Copy(ctx, "test/abc.txt", "copy/abc.md")
+	require.NoError(t, err)
+	src, ok := server.Object("bucket", "test/abc.txt")
+	require.True(t, ok)
+	obj, ok = server.Object("bucket", "copy/abc.md")
+	require.True(t, ok)
+	require.Equal(t, src.ContentType, obj.ContentType)
+	require.NotEmpty(t, obj.ContentType)
+	require.Equal(t, map[string]string{"owner": "alice"}, obj.Metadata)
+	tags, err := service.GetTags(ctx, "copy/abc.md")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"pii": "true"}, tags)
+
+	var keys []string
+	err = service.List(ctx, "", func(obj ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"copy/abc.md", "test/abc.txt"}, keys)
+
+	err = service.DeletePrefixed(ctx, "copy/")
+	require.NoError(t, err)
+	err = service.Delete(ctx, "test/abc.txt")
+	require.NoError(t, err)
+	require.Empty(t, server.Keys("bucket"))
+}
+
+func TestS3DeleteBatch(t *testing.T) {
+	t.Parallel()
+
+	service, server := newFakeS3(t, S3Options{DeleteBatchConcurrency: 2})
+	ctx := context.Background()
+	keys := make([]string, 1500)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("batch/%04d", i)
+		if i%100 == 0 {
+			err := service.Upload(ctx, keys[i], bytes.NewReader([]byte("x")))
+			require.NoError(t, err)
+		}
+	}
+
+	err := service.DeleteBatch(ctx, keys)
+	require.NoError(t, err)
+	require.Empty(t, server.Keys("bucket"))
+}
+
+func TestS3DeleteBatch_failures(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch {
+		case bytes.Contains(body, []byte("<Key>batch/0000</Key>")):
+			// per-key failure of the first chunk
+			w.Header().Set("Content-Type", "application/xml")
+			_, _ = w.Write([]byte(`<DeleteResult><Error><Key>batch/0000</Key><Code>AccessDenied</Code><Message>Access Denied</Message></Error></DeleteResult>`))
+		default:
+			// the second chunk fails as a whole
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+		}
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+	}
+	service, err := NewS3(cfg, "bucket", "", S3Options{Endpoint: server.URL, UsePathStyle: true})
+	require.NoError(t, err)
+	keys := make([]string, 1500)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("batch/%04d", i)
+	}
+
+	err = service.DeleteBatch(context.Background(), keys)
+	require.Error(t, err)
+	var batchErr *DeleteBatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.Equal(t, []string{"batch/0000"}, batchErr.Keys())
+	require.Contains(t, err.Error(), "StatusCode: 403")
+}
+
+func TestS3Copy_escapedKeys(t *testing.T) {
+	t.Parallel()
+
+	service, server := newFakeS3(t)
+	ctx := context.Background()
+	for _, key := range []string{"a b+c.txt", "q?x=1.txt", "100%/dir/file #1.txt"} {
+		err := service.Upload(ctx, key, strings.NewReader(key))
+		require.NoError(t, err)
+
+		err = service.Copy(ctx, key, "copy/"+key)
+		require.NoError(t, err, key)
+		obj, ok := server.Object("bucket", "copy/"+key)
+		require.True(t, ok, key)
+		require.Equal(t, key, string(obj.Data))
+
+		err = Transition(ctx, service, key, "STANDARD_IA")
+		require.NoError(t, err, key)
+		obj, ok = server.Object("bucket", key)
+		require.True(t, ok, key)
+		require.Equal(t, "STANDARD_IA", obj.StorageClass)
+	}
+}
+
+func TestS3Upload_multipart(t *testing.T) {
+	t.Parallel()
+
+	service, server := newFakeS3(t)
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("0123456789"), 1_200_000)
+	// not seekable, so the size is unknown before reading
+	err := service.Upload(ctx, "large.bin", io.MultiReader(bytes.NewReader(content)))
+	require.NoError(t, err)
+
+	obj, ok := server.Object("bucket", "large.bin")
+	require.True(t, ok)
+	require.Equal(t, len(content), len(obj.Data))
+	require.True(t, strings.HasSuffix(obj.ETag, `-3"`), obj.ETag)
+	require.Zero(t, server.Uploads("bucket"))
+
+	// downloaded by ranges
+	reader, err := service.Download(ctx, "large.bin")
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(content, data))
+}
+
+func TestS3SignURL(t *testing.T) {
+	t.Parallel()
+
+	service, server := newFakeS3(t)
+	ctx := context.Background()
+
+	signedURL, header, err := service.SignURL(ctx, "signed.txt", http.MethodPut, time.Minute)
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPut, signedURL, strings.NewReader("signed"))
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, []string{"signed.txt"}, server.Keys("bucket"))
+
+	signedURL, _, err = service.SignURL(ctx, "signed.txt", http.MethodGet, time.Minute)
+	require.NoError(t, err)
+	resp, err = http.Get(signedURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
 	require.NoError(t, err)
+	require.Equal(t, "signed", string(data))
 }
 
 func TestS3ACLFromContext(t *testing.T) {
@@ -34,3 +241,394 @@ func TestS3ACLFromContext(t *testing.T) {
 	acl = s3ACLFromContext(ctx)
 	require.Equal(t, types.ObjectCannedACLPublicRead, *acl)
 }
+
+func TestChunkStrings(t *testing.T) {
+	t.Parallel()
+
+	keys := make([]string, 2500)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+	}
+
+	chunks := chunkStrings(keys, s3MaxDeleteObjects)
+	require.Len(t, chunks, 3)
+	require.Len(t, chunks[0], 1000)
+	require.Len(t, chunks[1], 1000)
+	require.Len(t, chunks[2], 500)
+	require.Equal(t, "key-2499", chunks[2][499])
+
+	require.Empty(t, chunkStrings(nil, s3MaxDeleteObjects))
+}
+
+func TestDeleteBatchError(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, newDeleteBatchError(nil, nil))
+
+	err := newDeleteBatchError(
+		[]DeleteError{{Key: "a.txt", Code: "AccessDenied", Message: "Access Denied"}},
+		nil,
+		[]DeleteError{{Key: "b.txt", Code: "InternalError", Message: "We encountered an internal error"}},
+	)
+	var batchErr *DeleteBatchError
+	require.ErrorAs(t, err, &batchErr)
+	require.Equal(t, []string{"a.txt", "b.txt"}, batchErr.Keys())
+	require.Contains(t, err.Error(), "2 keys failed to delete")
+}
+
+func TestParseS3Restore(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, ArchiveStatus{}, parseS3Restore(""))
+
+	status := parseS3Restore(`ongoing-request="true"`)
+	require.True(t, status.Ongoing)
+	require.False(t, status.Restored())
+
+	status = parseS3Restore(`ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`)
+	require.False(t, status.Ongoing)
+	require.Equal(t, time.Date(2012, 12, 21, 0, 0, 0, 0, time.UTC), status.ExpiresAt)
+	require.True(t, status.Restored())
+}
+
+func TestS3Encryption(t *testing.T) {
+	t.Parallel()
+
+	key := bytes.Repeat([]byte{1}, 32)
+	cfg := aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+	}
+
+	_, err := NewS3(cfg, "bucket", "https://bucket.s3.amazonaws.com", S3Options{
+		Encryption: S3Encryption{Type: S3EncryptionCustomer, CustomerKey: key[:16]},
+	})
+	require.Error(t, err)
+
+	service, err := NewS3(cfg, "bucket", "https://bucket.s3.amazonaws.com", S3Options{
+		Encryption: S3Encryption{Type: S3EncryptionKMS, KMSKeyID: "alias/app", BucketKey: true},
+	})
+	require.NoError(t, err)
+
+	_, header, err := service.SignURL(context.Background(), "a.txt", http.MethodPut, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, "aws:kms", header.Get("X-Amz-Server-Side-Encryption"))
+	require.Equal(t, "alias/app", header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+
+	ctx := WithS3Encryption(context.Background(), S3Encryption{Type: S3EncryptionCustomer, CustomerKey: key})
+	_, header, err = service.SignURL(ctx, "a.txt", http.MethodGet, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, "AES256", header.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm"))
+	require.Equal(t, base64.StdEncoding.EncodeToString(key), header.Get("X-Amz-Server-Side-Encryption-Customer-Key"))
+	sum := md5.Sum(key)
+	require.Equal(t, base64.StdEncoding.EncodeToString(sum[:]), header.Get("X-Amz-Server-Side-Encryption-Customer-Key-Md5"))
+
+	// rotating SSE-C keys copies with the old key as source
+	input := &s3.CopyObjectInput{}
+	rotated := S3Encryption{Type: S3EncryptionCustomer, CustomerKey: bytes.Repeat([]byte{2}, 32)}
+	rotated.applyCopy(input, S3Encryption{Type: S3EncryptionCustomer, CustomerKey: key})
+	require.Equal(t, base64.StdEncoding.EncodeToString(rotated.CustomerKey), aws.ToString(input.SSECustomerKey))
+	require.Equal(t, base64.StdEncoding.EncodeToString(key), aws.ToString(input.CopySourceSSECustomerKey))
+	require.Empty(t, input.ServerSideEncryption)
+}
+
+func TestS3PublicEndpoint(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		apiEndpoint  string
+		bucket       string
+		region       string
+		usePathStyle bool
+		want         string
+	}{
+		{"", "bucket", "us-west-2", false, "https://bucket.s3.us-west-2.amazonaws.com"},
+		{"", "bucket", "", false, "https://bucket.s3.amazonaws.com"},
+		{"", "bucket", "us-west-2", true, "https://s3.us-west-2.amazonaws.com/bucket"},
+		{"", "my.bucket", "us-west-2", false, "https://s3.us-west-2.amazonaws.com/my.bucket"},
+		{"http://localhost:9000", "bucket", "us-east-1", true, "http://localhost:9000/bucket"},
+		{"https://account.r2.cloudflarestorage.com", "bucket", "auto", false, "https://bucket.account.r2.cloudflarestorage.com"},
+	}
+	for _, tt := range tests {
+		got, err := s3PublicEndpoint(tt.apiEndpoint, tt.bucket, tt.region, tt.usePathStyle)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, got)
+	}
+
+	_, err := s3PublicEndpoint("localhost:9000", "bucket", "", true)
+	require.Error(t, err)
+}
+
+func TestS3CompatibleEndpoint(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Range", "bytes 0-4/5")
+			w.Header().Set("Content-Length", "5")
+			_, _ = w.Write([]byte("hello"))
+		}
+	}))
+	defer server.Close()
+
+	cfg := aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+	}
+	service, err := NewS3(cfg, "bucket", "", S3Options{
+		Endpoint:          server.URL,
+		UsePathStyle:      true,
+		Region:            "auto",
+		ChecksumAlgorithm: types.ChecksumAlgorithmCrc32,
+		ValidateChecksum:  true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, server.URL+"/bucket/a/b.txt", service.URL("a/b.txt"))
+
+	ctx := context.Background()
+	err = service.Upload(ctx, "a/b.txt", bytes.NewReader([]byte("hello")))
+	require.NoError(t, err)
+	reader, err := service.Download(ctx, "a/b.txt")
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(data))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, requests, 2)
+	put, get := requests[0], requests[1]
+	require.Equal(t, http.MethodPut, put.Method)
+	require.Equal(t, "/bucket/a/b.txt", put.URL.Path)
+	require.Contains(t, put.Header.Get("Authorization"), "/auto/s3/aws4_request")
+	require.NotEmpty(t, put.Header.Get("X-Amz-Checksum-Crc32")+put.Header.Get("X-Amz-Trailer"))
+	require.Equal(t, "/bucket/a/b.txt", get.URL.Path)
+	require.Equal(t, "ENABLED", get.Header.Get("X-Amz-Checksum-Mode"))
+}
+
+func TestS3Versioning(t *testing.T) {
+	t.Parallel()
+
+	service, server := newFakeS3(t)
+	server.EnableVersioning("bucket")
+	ctx := context.Background()
+	for _, content := range []string{"v1", "v2"} {
+		err := service.Upload(ctx, "doc.txt", strings.NewReader(content))
+		require.NoError(t, err)
+	}
+	err := service.Upload(ctx, "doc.txt.bak", strings.NewReader("other"))
+	require.NoError(t, err)
+
+	versions, err := ListVersions(ctx, service, "doc.txt")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.True(t, versions[0].IsLatest)
+	require.False(t, versions[1].IsLatest)
+
+	reader, err := DownloadVersion(ctx, service, "doc.txt", versions[1].VersionID)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "v1", string(data))
+
+	err = RestoreVersion(ctx, service, "doc.txt", versions[1].VersionID)
+	require.NoError(t, err)
+	obj, ok := server.Object("bucket", "doc.txt")
+	require.True(t, ok)
+	require.Equal(t, "v1", string(obj.Data))
+	require.Equal(t, "INTELLIGENT_TIERING", obj.StorageClass)
+
+	// deleting creates a delete marker
+	err = service.Delete(ctx, "doc.txt")
+	require.NoError(t, err)
+	exist, err := service.Exist(ctx, "doc.txt")
+	require.NoError(t, err)
+	require.False(t, exist)
+	versions, err = ListVersions(ctx, service, "doc.txt")
+	require.NoError(t, err)
+	require.Len(t, versions, 4)
+	require.True(t, versions[0].DeleteMarker)
+	require.True(t, versions[0].IsLatest)
+
+	err = DeleteVersion(ctx, service, "doc.txt", versions[0].VersionID)
+	require.NoError(t, err)
+	exist, err = service.Exist(ctx, "doc.txt")
+	require.NoError(t, err)
+	require.True(t, exist)
+
+	// missing versions and keys match fs.ErrNotExist
+	_, err = DownloadVersion(ctx, service, "doc.txt", "missing")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = DownloadVersion(ctx, service, "missing.txt", versions[1].VersionID)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	err = CopyVersion(ctx, service, "doc.txt", "missing", "copy.txt")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	// keys of copied versions are escaped before the version
+	err = service.Upload(ctx, "doc?versionId=x.txt", strings.NewReader("escaped"))
+	require.NoError(t, err)
+	versions, err = ListVersions(ctx, service, "doc?versionId=x.txt")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	err = CopyVersion(ctx, service, "doc?versionId=x.txt", versions[0].VersionID, "escaped.txt")
+	require.NoError(t, err)
+	obj, ok = server.Object("bucket", "escaped.txt")
+	require.True(t, ok)
+	require.Equal(t, "escaped", string(obj.Data))
+	err = RestoreVersion(ctx, service, "doc.txt", "missing")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestS3Expiration(t *testing.T) {
+	t.Parallel()
+
+	service, _ := newFakeS3(t)
+	ctx := context.Background()
+
+	err := SetExpiration(ctx, service, "tmp/", 1)
+	require.NoError(t, err)
+	err = SetExpiration(ctx, service, "cache/", 7)
+	require.NoError(t, err)
+	err = SetExpiration(ctx, service, "tmp/", 2)
+	require.NoError(t, err)
+
+	rules, err := service.lifecycleRules(ctx)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	days := make(map[string]int32)
+	for _, rule := range rules {
+		days[aws.ToString(rule.ID)] = rule.Expiration.Days
+	}
+	require.Equal(t, map[string]int32{s3ExpirationRuleID("tmp/"): 2, s3ExpirationRuleID("cache/"): 7}, days)
+
+	err = RemoveExpiration(ctx, service, "tmp/")
+	require.NoError(t, err)
+	err = RemoveExpiration(ctx, service, "cache/")
+	require.NoError(t, err)
+	rules, err = service.lifecycleRules(ctx)
+	require.NoError(t, err)
+	require.Empty(t, rules)
+
+	// TTL per object is not supported
+	ttl := WithTTL(ctx, time.Hour)
+	require.ErrorIs(t, service.Upload(ttl, "tmp/a.txt", strings.NewReader("a")), ErrNotSupported)
+	require.NoError(t, service.Upload(ctx, "tmp/a.txt", strings.NewReader("a")))
+	require.ErrorIs(t, service.Copy(ttl, "tmp/a.txt", "tmp/b.txt"), ErrNotSupported)
+}
+
+func TestS3Encryption_server(t *testing.T) {
+	t.Parallel()
+
+	service, server := newFakeS3(t, S3Options{
+		Encryption: S3Encryption{Type: S3EncryptionKMS, KMSKeyID: "alias/app", BucketKey: true},
+	})
+	ctx := context.Background()
+	err := service.Upload(ctx, "kms.txt", strings.NewReader("kms"))
+	require.NoError(t, err)
+	obj, ok := server.Object("bucket", "kms.txt")
+	require.True(t, ok)
+	require.Equal(t, "aws:kms", obj.ServerSideEncryption)
+	require.Equal(t, "alias/app", obj.KMSKeyID)
+	require.True(t, obj.BucketKeyEnabled)
+
+	key := bytes.Repeat([]byte{1}, 32)
+	sseC := WithS3Encryption(ctx, S3Encryption{Type: S3EncryptionCustomer, CustomerKey: key})
+	err = service.Upload(sseC, "sse-c.txt", strings.NewReader("secret"))
+	require.NoError(t, err)
+
+	_, err = service.Download(ctx, "sse-c.txt")
+	require.Error(t, err)
+	reader, err := service.Download(sseC, "sse-c.txt")
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "secret", string(data))
+
+	// rotate the key by copying in place
+	rotated := bytes.Repeat([]byte{2}, 32)
+	rotateCtx := WithS3Encryption(ctx, S3Encryption{Type: S3EncryptionCustomer, CustomerKey: rotated})
+	rotateCtx = WithS3SourceEncryption(rotateCtx, S3Encryption{Type: S3EncryptionCustomer, CustomerKey: key})
+	err = service.Copy(rotateCtx, "sse-c.txt", "sse-c.txt")
+	require.NoError(t, err)
+	_, err = service.Stat(sseC, "sse-c.txt")
+	require.Error(t, err)
+	info, err := service.Stat(WithS3Encryption(ctx, S3Encryption{Type: S3EncryptionCustomer, CustomerKey: rotated}), "sse-c.txt")
+	require.NoError(t, err)
+	require.Equal(t, int64(6), info.Size)
+}
+
+func TestS3Archive(t *testing.T) {
+	t.Parallel()
+
+	service, server := newFakeS3(t)
+	ctx := context.Background()
+	err := service.Upload(WithS3PublicRead(ctx), "archive.txt", strings.NewReader("cold"))
+	require.NoError(t, err)
+
+	err = Transition(ctx, service, "archive.txt", "GLACIER")
+	require.NoError(t, err)
+	// transitions keep the ACL
+	obj, ok := server.Object("bucket", "archive.txt")
+	require.True(t, ok)
+	require.Equal(t, "GLACIER", obj.StorageClass)
+	require.Equal(t, "public-read", obj.ACL)
+	status, err := RestoreStatus(ctx, service, "archive.txt")
+	require.NoError(t, err)
+	require.True(t, status.Archived)
+	require.False(t, status.Restored())
+	_, err = service.Download(ctx, "archive.txt")
+	require.Error(t, err)
+
+	err = Restore(ctx, service, "archive.txt", RestoreOptions{Days: 2})
+	require.NoError(t, err)
+	status, err = RestoreStatus(ctx, service, "archive.txt")
+	require.NoError(t, err)
+	require.True(t, status.Restored())
+	reader, err := service.Download(ctx, "archive.txt")
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, "cold", string(data))
+
+	// the ACL of the context replaces it
+	err = service.Upload(WithS3PublicRead(ctx), "private.txt", strings.NewReader("cold"))
+	require.NoError(t, err)
+	err = Transition(WithS3Private(ctx), service, "private.txt", "STANDARD_IA")
+	require.NoError(t, err)
+	obj, ok = server.Object("bucket", "private.txt")
+	require.True(t, ok)
+	require.Equal(t, "STANDARD_IA", obj.StorageClass)
+	require.Equal(t, "private", obj.ACL)
+
+	err = Transition(ctx, service, "none.txt", "GLACIER")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	// INTELLIGENT_TIERING objects in archive tiers must be restored
+	for _, tier := range []string{"ARCHIVE_ACCESS", "DEEP_ARCHIVE_ACCESS"} {
+		key := strings.ToLower(tier) + ".txt"
+		err = service.Upload(ctx, key, strings.NewReader("tiered"))
+		require.NoError(t, err)
+		require.True(t, server.Archive("bucket", key, tier))
+		status, err = RestoreStatus(ctx, service, key)
+		require.NoError(t, err)
+		require.Equal(t, "INTELLIGENT_TIERING", status.StorageClass)
+		require.True(t, status.Archived, tier)
+		_, err = service.Download(ctx, key)
+		require.Error(t, err)
+
+		err = Restore(ctx, service, key, RestoreOptions{})
+		require.NoError(t, err)
+		status, err = RestoreStatus(ctx, service, key)
+		require.NoError(t, err)
+		require.False(t, status.Archived, tier)
+		reader, err := service.Download(ctx, key)
+		require.NoError(t, err)
+		require.NoError(t, reader.Close())
+	}
+}
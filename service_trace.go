@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+var _ Service = (*tracedService)(nil)
+
+type tracedService struct {
+	service Service
+	tracer  Tracer
+	backend string
+}
+
+// NewTracedService wraps service to start a span for every call, such as "storage.upload".
+// If tracer is nil, the tracer is taken from ctx, see ContextWithTracer.
+func NewTracedService(service Service, tracer Tracer) Service {
+	return &tracedService{
+		service: service,
+		tracer:  tracer,
+		backend: backendName(service),
+	}
+}
+
+func (s *tracedService) start(ctx context.Context, op string, attrs ...Attribute) (context.Context, Span) {
+	attrs = append(attrs, Attr("storage.backend", s.backend))
+	if s.tracer != nil {
+		return s.tracer.Start(ctx, "storage."+op, attrs...)
+	}
+	return startSpan(ctx, "storage."+op, attrs...)
+}
+
+func (s *tracedService) Upload(ctx context.Context, key string, reader io.Reader) error {
+	ctx, span := s.start(ctx, "upload", Attr("storage.key", key))
+	counter, reader := newCountingReader(reader)
+	err := s.service.Upload(ctx, key, reader)
+	span.SetAttributes(Attr("storage.bytes", counter.n))
+	span.End(err)
+	return err
+}
+
+// Download ends the span when the returned reader is closed.
+func (s *tracedService) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	ctx, span := s.start(ctx, "download", Attr("storage.key", key))
+	reader, err := s.service.Download(ctx, key)
+	if err != nil {
+		span.End(err)
+		return nil, err
+	}
+
+	return &observedReadCloser{
+		countingReader: countingReader{reader: reader},
+		closer:         reader,
+		observe: func(n int64, err error) {
+			span.SetAttributes(Attr("storage.bytes", n))
+			span.End(err)
+		},
+	}, nil
+}
+
+func (s *tracedService) Copy(ctx context.Context, src string, dst string) error {
+	ctx, span := s.start(ctx, "copy", Attr("storage.src", src), Attr("storage.key", dst))
+	err := s.service.Copy(ctx, src, dst)
+	span.End(err)
+	return err
+}
+
+func (s *tracedService) Delete(ctx context.Context, key string) error {
+	ctx, span := s.start(ctx, "delete", Attr("storage.key", key))
+	err := s.service.Delete(ctx, key)
+	span.End(err)
+	return err
+}
+
+func (s *tracedService) DeleteBatch(ctx context.Context, keys []string) error {
+	ctx, span := s.start(ctx, "delete_batch", Attr("storage.keys", len(keys)))
+	err := s.service.DeleteBatch(ctx, keys)
+	span.End(err)
+	return err
+}
+
+func (s *tracedService) DeletePrefixed(ctx context.Context, prefix string) error {
+	ctx, span := s.start(ctx, "delete_prefixed", Attr("storage.prefix", prefix))
+	err := s.service.DeletePrefixed(ctx, prefix)
+	span.End(err)
+	return err
+}
+
+func (s *tracedService) Exist(ctx context.Context, key string) (bool, error) {
+	ctx, span := s.start(ctx, "exist", Attr("storage.key", key))
+	exist, err := s.service.Exist(ctx, key)
+	span.SetAttributes(Attr("storage.exist", exist))
+	span.End(err)
+	return exist, err
+}
+
+func (s *tracedService) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	ctx, span := s.start(ctx, "stat", Attr("storage.key", key))
+	info, err := Stat(ctx, s.service, key)
+	span.End(err)
+	return info, err
+}
+
+func (s *tracedService) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	ctx, span := s.start(ctx, "list", Attr("storage.prefix", prefix))
+	err := List(ctx, s.service, prefix, fn)
+	span.End(err)
+	return err
+}
+
+func (s *tracedService) URL(key string) string {
+	return s.service.URL(key)
+}
+
+func (s *tracedService) SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error) {
+	ctx, span := s.start(ctx, "sign_url", Attr("storage.key", key), Attr("http.method", method))
+	u, header, err := s.service.SignURL(ctx, key, method, expiresIn)
+	span.End(err)
+	return u, header, err
+}
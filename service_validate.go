@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrInvalidContent is matched by errors of uploads rejected by the service created by NewValidatedService.
+var ErrInvalidContent = errors.New("invalid content")
+
+// ValidationError is returned for uploads violating ValidationRules. It matches ErrInvalidContent.
+type ValidationError struct {
+	Key    string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid content of %q: %s", e.Key, e.Reason)
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidContent
+}
+
+// ValidationRules are checked by the service created by NewValidatedService.
+type ValidationRules struct {
+	// ContentTypes allows content sniffed as these types, such as "image/" or "application/pdf".
+	// Types ending with "/" match by prefix. Empty allows all types.
+	ContentTypes []string
+	// MaxSize rejects files larger than this in bytes. Zero means unlimited.
+	MaxSize int64
+	// MatchExtension rejects content not matching the extension of the key, such as a PDF named "a.jpg".
+	// Keys with unknown extensions are not checked.
+	MatchExtension bool
+}
+
+var _ Service = (*validatedService)(nil)
+
+type validatedService struct {
+	service Service
+	rules   ValidationRules
+}
+
+// NewValidatedService wraps service to check uploads against rules. Content type is sniffed from content,
+// ignoring WithContentType, and size is checked while streaming. Uploads violating rules are aborted,
+// and partially written new objects are deleted. Streams overwriting existing objects are uploaded to
+// a temporary key and copied into place, so rejected ones don't truncate the existing object.
+func NewValidatedService(service Service, rules ValidationRules) Service {
+	return &validatedService{
+		service: service,
+		rules:   rules,
+	}
+}
+
+func (s *validatedService) Upload(ctx context.Context, key string, reader io.Reader) error {
+	sniffed, reader, err := DetectContentType(reader)
+	if err != nil {
+		return err
+	}
+	if err := s.checkType(key, sniffed); err != nil {
+		return err
+	}
+
+	if s.rules.MaxSize <= 0 {
+		return s.service.Upload(ctx, key, reader)
+	}
+
+	tooLarge := &ValidationError{Key: key, Reason: fmt.Sprintf("larger than %d bytes", s.rules.MaxSize)}
+	size, ok := readerSize(reader)
+	if ok && size > s.rules.MaxSize {
+		return tooLarge
+	}
+	limited := &limitReader{reader: reader, remaining: s.rules.MaxSize, err: tooLarge}
+	if ok {
+		return s.service.Upload(ctx, key, limited)
+	}
+
+	exist, err := s.service.Exist(ctx, key)
+	if err != nil {
+		return err
+	}
+	if exist {
+		return uploadReplacing(ctx, s.service, key, limited)
+	}
+
+	err = s.service.Upload(ctx, key, limited)
+	if err != nil && errors.Is(err, ErrInvalidContent) {
+		_ = s.service.Delete(context.WithoutCancel(ctx), key)
+	}
+	return err
+}
+
+func (s *validatedService) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.service.Download(ctx, key)
+}
+
+// Copy checks the content type of src against the extension of dst if MatchExtension is set and service implements Stater.
+func (s *validatedService) Copy(ctx context.Context, src string, dst string) error {
+	if s.rules.MatchExtension {
+		info, err := Stat(ctx, s.service, src)
+		if err != nil && !errors.Is(err, ErrNotSupported) {
+			return err
+		}
+		if err == nil {
+			if err := s.checkExtension(dst, info.ContentType); err != nil {
+				return err
+			}
+		}
+	}
+	return s.service.Copy(ctx, src, dst)
+}
+
+func (s *validatedService) Delete(ctx context.Context, key string) error {
+	return s.service.Delete(ctx, key)
+}
+
+func (s *validatedService) DeleteBatch(ctx context.Context, keys []string) error {
+	return s.service.DeleteBatch(ctx, keys)
+}
+
+func (s *validatedService) DeletePrefixed(ctx context.Context, prefix string) error {
+	return s.service.DeletePrefixed(ctx, prefix)
+}
+
+func (s *validatedService) Exist(ctx context.Context, key string) (bool, error) {
+	return s.service.Exist(ctx, key)
+}
+
+func (s *validatedService) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	return Stat(ctx, s.service, key)
+}
+
+func (s *validatedService) List(ctx context.Context, prefix string, fn func(obj ObjectInfo) error) error {
+	return List(ctx, s.service, prefix, fn)
+}
+
+func (s *validatedService) URL(key string) string {
+	return s.service.URL(key)
+}
+
+// SignURL refuses "PUT", because uploads by signed URLs bypass validation.
+func (s *validatedService) SignURL(ctx context.Context, key string, method string, expiresIn time.Duration) (string, http.Header, error) {
+	if method == http.MethodPut {
+		return "", nil, ErrNotSupported
+	}
+	return s.service.SignURL(ctx, key, method, expiresIn)
+}
+
+func (s *validatedService) checkType(key string, sniffed string) error {
+	if len(s.rules.ContentTypes) > 0 {
+		mediaType := validatedType(sniffed, MimeTypeByExtension(path.Ext(key)))
+		allowed := false
+		for _, t := range s.rules.ContentTypes {
+			if strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) || mediaType == t {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &ValidationError{Key: key, Reason: fmt.Sprintf("content type %q not allowed", mediaType)}
+		}
+	}
+
+	if s.rules.MatchExtension {
+		return s.checkExtension(key, sniffed)
+	}
+	return nil
+}
+
+func (s *validatedService) checkExtension(key string, contentType string) error {
+	byExtension := MimeTypeByExtension(path.Ext(key))
+	if byExtension == "" {
+		return nil
+	}
+	if validatedType(contentType, byExtension) != mediaTypeOf(byExtension) {
+		return &ValidationError{
+			Key:    key,
+			Reason: fmt.Sprintf("content type %q doesn't match extension %q", mediaTypeOf(contentType), path.Ext(key)),
+		}
+	}
+	return nil
+}
+
+// validatedType returns the media type of sniffed, refined by the type of extension when sniffed is generic
+// but compatible, such as text sniffed as "text/plain" named "a.json". Unknown binary content is never refined,
+// so it can't pass as the type of its extension.
+func validatedType(sniffed, byExtension string) string {
+	mediaType := mediaTypeOf(sniffed)
+	ext := mediaTypeOf(byExtension)
+	if ext == "" {
+		return mediaType
+	}
+
+	switch mediaType {
+	case "text/plain", "text/xml":
+		// text formats such as JSON, CSV and SVG
+		if strings.HasPrefix(ext, "text/") || strings.HasSuffix(ext, "+xml") || strings.HasSuffix(ext, "/xml") ||
+			ext == "application/json" || ext == "application/javascript" {
+			return ext
+		}
+	case "application/zip":
+		// zip based formats such as docx and epub
+		if strings.HasSuffix(ext, "+zip") || strings.Contains(ext, "openxmlformats") ||
+			strings.Contains(ext, "opendocument") || ext == "application/java-archive" {
+			return ext
+		}
+	}
+	return mediaType
+}
+
+// mediaTypeOf strips parameters of contentType, such as "; charset=utf-8".
+func mediaTypeOf(contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.TrimSpace(mediaType)
+}
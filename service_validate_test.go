@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatedService(t *testing.T) {
+	t.Parallel()
+
+	backend, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	service := NewValidatedService(backend, ValidationRules{
+		ContentTypes:   []string{"image/", "application/json"},
+		MaxSize:        1024,
+		MatchExtension: true,
+	})
+	ctx := context.TODO()
+	jpeg := "\xff\xd8\xff\xe0" + strings.Repeat("x", 100)
+
+	require.NoError(t, service.Upload(ctx, "a.jpg", strings.NewReader(jpeg)))
+	require.NoError(t, service.Upload(ctx, "a.json", strings.NewReader(`{"a":1}`)))
+
+	var validationErr *ValidationError
+	tests := map[string]string{
+		"b.jpg":  "%PDF-1.7\n",                  // type not allowed
+		"b.png":  jpeg,                          // extension mismatch
+		"c.jpg":  "\x00\x01\x02 unknown binary", // unknown content can't pass as its extension
+		"d.jpg":  jpeg + strings.Repeat("x", 1024),
+		"d.json": `{"a":"` + strings.Repeat("x", 1024) + `"}`,
+	}
+	for key, content := range tests {
+		// a reader of unknown size is checked while streaming
+		err := service.Upload(ctx, key, io.MultiReader(strings.NewReader(content)))
+		require.ErrorAs(t, err, &validationErr, key)
+		require.ErrorIs(t, err, ErrInvalidContent)
+
+		exist, err := backend.Exist(ctx, key)
+		require.NoError(t, err)
+		require.False(t, exist, key)
+	}
+
+	// rejected streams keep the overwritten object
+	err = service.Upload(ctx, "a.jpg", io.MultiReader(strings.NewReader(jpeg+strings.Repeat("x", 1024))))
+	require.ErrorIs(t, err, ErrInvalidContent)
+	reader, err := backend.Download(ctx, "a.jpg")
+	require.NoError(t, err)
+	b, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, jpeg, string(b))
+	var keys []string
+	require.NoError(t, List(ctx, backend, "", func(obj ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	}))
+	require.Equal(t, []string{"a.jpg", "a.json"}, keys)
+
+	require.ErrorIs(t, service.Copy(ctx, "a.jpg", "a.png"), ErrInvalidContent)
+	require.NoError(t, service.Copy(ctx, "a.jpg", "b.jpeg"))
+}
@@ -59,6 +59,8 @@ type ServerOptions struct {
 	SigningKey []byte
 	// Expire duration for signed serving URL
 	SigningExpires time.Duration
+	// Tracer starts a span for every request and is propagated through ctx to variant processing.
+	Tracer Tracer
 }
 
 type ServerOption func(o *ServerOptions)
@@ -71,6 +73,7 @@ type storageServer struct {
 	urlResolver    func(string) string
 	urlSigner      URLSigner
 	signingExpires time.Duration
+	tracer         Tracer
 }
 
 // NewServer creates a new server. keyEncoder and keyDecoder are optional.
@@ -99,6 +102,7 @@ func NewServer(endpoint string, storage Storage, options ...ServerOption) Server
 		urlResolver:    opts.URLResolver,
 		urlSigner:      urlSigner,
 		signingExpires: opts.SigningExpires,
+		tracer:         opts.Tracer,
 	}
 }
 
@@ -141,8 +145,14 @@ func (s storageServer) Handler() http.Handler {
 		}
 
 		// variant file
+		ctx := r.Context()
+		if s.tracer != nil {
+			ctx = ContextWithTracer(ctx, s.tracer)
+		}
+		ctx, span := startSpan(ctx, "storage.serve", Attr("storage.key", key))
 		variant := s.storage.Variant(key, options)
-		err = variant.Process()
+		err = ProcessVariant(ctx, variant)
+		span.End(err)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			_, _ = w.Write([]byte(err.Error()))
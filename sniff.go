@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// sniffLen is the number of bytes peeked to detect content types, as many as http.DetectContentType considers.
+const sniffLen = 512
+
+// magicNumbers detects formats unknown to http.DetectContentType, checked in order.
+var magicNumbers = []struct {
+	offset      int
+	magic       []byte
+	contentType string
+}{
+	{4, []byte("ftypheic"), "image/heic"},
+	{4, []byte("ftypheix"), "image/heic"},
+	{4, []byte("ftyphevc"), "image/heic-sequence"},
+	{4, []byte("ftypmif1"), "image/heif"},
+	{4, []byte("ftypmsf1"), "image/heif-sequence"},
+	{4, []byte("ftypavif"), "image/avif"},
+	{4, []byte("ftypavis"), "image/avif"},
+	{4, []byte("ftypqt  "), "video/quicktime"},
+	{4, []byte("ftypM4A "), "audio/mp4"},
+	{0, []byte("\x00\x00\x01\x00"), "image/x-icon"},
+	{0, []byte("II*\x00"), "image/tiff"},
+	{0, []byte("MM\x00*"), "image/tiff"},
+	{0, []byte("\xff\x0a"), "image/jxl"},
+	{0, []byte("\x00\x00\x00\x0cJXL \x0d\x0a\x87\x0a"), "image/jxl"},
+	{0, []byte("7z\xbc\xaf\x27\x1c"), "application/x-7z-compressed"},
+	{0, []byte("\xfd7zXZ\x00"), "application/x-xz"},
+	{0, []byte("\x28\xb5\x2f\xfd"), "application/zstd"},
+	{0, []byte("BZh"), "application/x-bzip2"},
+	{257, []byte("ustar"), "application/x-tar"},
+	{0, []byte("fLaC"), "audio/flac"},
+	{0, []byte("SQLite format 3\x00"), "application/vnd.sqlite3"},
+}
+
+// genericContentTypes are sniffed types less specific than types by extension, such as ".svg" sniffed as "text/xml".
+var genericContentTypes = []string{
+	"application/octet-stream",
+	"text/plain",
+	"text/xml",
+	"application/zip",
+}
+
+// SniffContentType returns the content type of data, the first bytes of a file.
+// It detects HEIC, HEIF, AVIF, TIFF and other formats besides formats of http.DetectContentType,
+// such as WebP, PDF and ZIP. It returns "application/octet-stream" for unknown data.
+func SniffContentType(data []byte) string {
+	for _, m := range magicNumbers {
+		if len(data) >= m.offset+len(m.magic) && bytes.Equal(data[m.offset:m.offset+len(m.magic)], m.magic) {
+			return m.contentType
+		}
+	}
+	return http.DetectContentType(data)
+}
+
+// DetectContentType peeks the first bytes of reader to detect its content type. The returned reader reads
+// all content of reader, it's reader itself rewound if reader implements io.Seeker.
+func DetectContentType(reader io.Reader) (string, io.Reader, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(reader, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", nil, err
+	}
+	head = head[:n]
+	contentType := SniffContentType(head)
+
+	if seeker, ok := reader.(io.Seeker); ok {
+		if _, err := seeker.Seek(int64(-n), io.SeekCurrent); err == nil {
+			return contentType, reader, nil
+		}
+	}
+	return contentType, io.MultiReader(bytes.NewReader(head), reader), nil
+}
+
+// detectUploadContentType returns the content type of an upload of key, and the reader to upload.
+// The content type set by WithContentType wins, otherwise it's sniffed from content,
+// falling back to the extension of key if sniffing gives a generic type.
+func detectUploadContentType(ctx context.Context, key string, reader io.Reader) (string, io.Reader, error) {
+	if ct := contentTypeFromContext(ctx); ct != "" {
+		return ct, reader, nil
+	}
+
+	sniffed, reader, err := DetectContentType(reader)
+	if err != nil {
+		return "", nil, err
+	}
+	return preferredContentType(sniffed, MimeTypeByExtension(path.Ext(key))), reader, nil
+}
+
+// preferredContentType returns sniffed unless it's generic and byExtension is known.
+func preferredContentType(sniffed, byExtension string) string {
+	if byExtension == "" {
+		return sniffed
+	}
+	mediaType, _, _ := strings.Cut(sniffed, ";")
+	for _, t := range genericContentTypes {
+		if mediaType == t {
+			return byExtension
+		}
+	}
+	return sniffed
+}
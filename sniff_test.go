@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSniffContentType(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"\x00\x00\x00\x18ftypheic\x00\x00\x00\x00": "image/heic",
+		"\x00\x00\x00\x1cftypavif\x00\x00\x00\x00": "image/avif",
+		"RIFF\x00\x00\x00\x00WEBPVP8 ":             "image/webp",
+		"%PDF-1.7\n":                               "application/pdf",
+		"PK\x03\x04":                               "application/zip",
+		"\xff\xd8\xff\xe0":                         "image/jpeg",
+		"II*\x00":                                  "image/tiff",
+		"hello":                                    "text/plain; charset=utf-8",
+	}
+	for data, want := range tests {
+		require.Equal(t, want, SniffContentType([]byte(data)), data)
+	}
+}
+
+func TestDetectContentType(t *testing.T) {
+	t.Parallel()
+
+	content := "%PDF-1.7\n" + strings.Repeat("x", 1000)
+
+	// non seekable readers replay peeked bytes
+	contentType, reader, err := DetectContentType(io.MultiReader(strings.NewReader(content)))
+	require.NoError(t, err)
+	require.Equal(t, "application/pdf", contentType)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, content, string(data))
+
+	// seekable readers are rewound
+	seeker := bytes.NewReader([]byte(content))
+	_, reader, err = DetectContentType(seeker)
+	require.NoError(t, err)
+	require.Same(t, seeker, reader)
+	require.Equal(t, len(content), seeker.Len())
+}
+
+func TestUploadContentType(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewDiskService(t.TempDir(), "http://localhost/disk")
+	require.NoError(t, err)
+	ctx := context.TODO()
+
+	tests := []struct {
+		key     string
+		content string
+		ctx     context.Context
+		want    string
+	}{
+		// sniffed content wins over a wrong extension
+		{"a.jpg", "%PDF-1.7\n", ctx, "application/pdf"},
+		// generic sniffed types fall back to the extension
+		{"a.json", `{"a":1}`, ctx, "application/json"},
+		{"a", "\x00\x01", ctx, "application/octet-stream"},
+		{"b.txt", "%PDF-1.7\n", WithContentType(ctx, "text/plain"), "text/plain"},
+	}
+	for _, tt := range tests {
+		require.NoError(t, service.Upload(tt.ctx, tt.key, strings.NewReader(tt.content)))
+		info, err := Stat(ctx, service, tt.key)
+		require.NoError(t, err)
+		require.Equal(t, tt.want, info.ContentType, tt.key)
+	}
+
+	require.NoError(t, service.Copy(ctx, "a.jpg", "c.jpg"))
+	info, err := Stat(ctx, service, "c.jpg")
+	require.NoError(t, err)
+	require.Equal(t, "application/pdf", info.ContentType)
+}
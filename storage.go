@@ -1,26 +1,73 @@
 package storage
 
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+)
+
 type Storage interface {
 	// TODO: Service
 	Service() Service
 	Variant(key string, options VariantOptions) Variant
+	// Blobs returns the store of blobs created by Create.
+	Blobs() BlobStore
+	// Create uploads content of reader under a new key generated for filename and records the blob.
+	// It returns an error matching ErrBlobExists without uploading if a blob of the key exists, such as
+	// the same content with ContentHashKeys. The object is deleted if the blob can't be recorded.
+	Create(ctx context.Context, reader io.Reader, filename string) (Blob, error)
+}
+
+// StorageOptions configures the storage created by New.
+type StorageOptions struct {
+	// Blobs records blobs created by Storage.Create. Default is NewMemoryBlobStore().
+	Blobs BlobStore
+	// Keys generates keys of blobs. Default is RandomKeys().
+	Keys KeyGenerator
+	// Analyzers analyze files while Create uploads them, metadata found is added to Blob.Metadata.
+	// Failed analysis doesn't fail Create.
+	Analyzers []Analyzer
 }
 
 type storage struct {
 	service        Service
 	variantFactory VariantFactory
+	blobs          BlobStore
+	keys           KeyGenerator
+	analyzers      []Analyzer
 }
 
 // New creates a new storage. If variantFactory is nil, NewVariantFactory(NewTransformer()) will be used.
-func New(service Service, variantFactory VariantFactory) Storage {
+func New(service Service, variantFactory VariantFactory, options ...StorageOptions) Storage {
 	if variantFactory == nil {
 		variantFactory = NewVariantFactory(NewTransformer())
 	}
 
-	return &storage{
+	s := &storage{
 		service:        service,
 		variantFactory: variantFactory,
+		blobs:          NewMemoryBlobStore(),
+		keys:           RandomKeys(),
+	}
+	for _, opt := range options {
+		if opt.Blobs != nil {
+			s.blobs = opt.Blobs
+		}
+		if opt.Keys != nil {
+			s.keys = opt.Keys
+		}
+		if opt.Analyzers != nil {
+			s.analyzers = opt.Analyzers
+		}
 	}
+
+	return s
 }
 
 func (s *storage) Service() Service {
@@ -30,3 +77,107 @@ func (s *storage) Service() Service {
 func (s *storage) Variant(key string, options VariantOptions) Variant {
 	return s.variantFactory.NewVariant(s.service, key, options)
 }
+
+func (s *storage) Blobs() BlobStore {
+	return s.blobs
+}
+
+func (s *storage) Create(ctx context.Context, reader io.Reader, filename string) (Blob, error) {
+	key, err := s.keys.GenerateKey(ctx, filename, reader)
+	if err != nil {
+		return Blob{}, err
+	}
+
+	// sniff content like backends do, but prefer the extension of filename over generic types,
+	// since keys may not keep the extension
+	contentType := contentTypeFromContext(ctx)
+	if contentType == "" {
+		var sniffed string
+		sniffed, reader, err = DetectContentType(reader)
+		if err != nil {
+			return Blob{}, err
+		}
+		contentType = preferredContentType(sniffed, MimeTypeByExtension(path.Ext(filename)))
+		ctx = WithContentType(ctx, contentType)
+	}
+
+	// keys of content hashes are shared by blobs of the same content, don't overwrite the object of the existing blob
+	if _, err := s.blobs.Find(ctx, key); err == nil {
+		return Blob{}, fmt.Errorf("%w: %q", ErrBlobExists, key)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return Blob{}, err
+	}
+
+	hash := md5.New()
+	var w io.Writer = hash
+	analysis := s.analyze(ctx, contentType, &w)
+	counter, r := newCountingReader(io.TeeReader(reader, w))
+	err = s.service.Upload(ctx, key, r)
+	analyzed := analysis(err)
+	if err != nil {
+		return Blob{}, err
+	}
+
+	// the map of the context is shared with the caller
+	metadata := copyMetadata(metadataFromContext(ctx))
+	if len(analyzed) > 0 {
+		if metadata == nil {
+			metadata = make(map[string]string, len(analyzed))
+		}
+		for k, v := range analyzed {
+			metadata[k] = v
+		}
+	}
+
+	blob := Blob{
+		Key:         key,
+		Filename:    path.Base(filename),
+		ContentType: contentType,
+		ByteSize:    counter.n,
+		Checksum:    base64.StdEncoding.EncodeToString(hash.Sum(nil)),
+		Metadata:    metadata,
+		CreatedAt:   time.Now().UTC(),
+	}
+	err = s.blobs.Create(ctx, blob)
+	if err != nil {
+		// keep the object if a blob of the same key was created meanwhile, or if it's unknown
+		if _, findErr := s.blobs.Find(ctx, key); errors.Is(findErr, fs.ErrNotExist) {
+			_ = s.service.Delete(context.WithoutCancel(ctx), key)
+		}
+		return Blob{}, err
+	}
+	return blob, nil
+}
+
+// analyze starts analysis of content written to w by the first analyzer accepting contentType.
+// The returned func waits for the result after the upload finished with err.
+func (s *storage) analyze(ctx context.Context, contentType string, w *io.Writer) func(err error) map[string]string {
+	var analyzer Analyzer
+	for _, a := range s.analyzers {
+		if a.Accept(contentType) {
+			analyzer = a
+			break
+		}
+	}
+	if analyzer == nil {
+		return func(error) map[string]string { return nil }
+	}
+
+	pr, pw := io.Pipe()
+	*w = io.MultiWriter(*w, pw)
+	result := make(chan map[string]string, 1)
+	go func() {
+		metadata, err := analyzer.Analyze(ctx, pr)
+		// drain content the analyzer didn't read so the upload isn't blocked
+		_, _ = io.Copy(io.Discard, pr)
+		if err != nil {
+			metadata = nil
+		}
+		result <- metadata
+	}()
+
+	return func(err error) map[string]string {
+		pw.CloseWithError(err)
+		return <-result
+	}
+}
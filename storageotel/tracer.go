@@ -0,0 +1,80 @@
+// Package storageotel adapts OpenTelemetry tracing to storage.Tracer. It's a separate module,
+// so importers of go-storage don't depend on OpenTelemetry.
+//
+//	tracer := storageotel.NewTracer(otel.Tracer("github.com/bastengao/go-storage"))
+//	service = storage.NewTracedService(service, tracer)
+//	server := storage.NewServer(endpoint, store, func(o *storage.ServerOptions) {
+//		o.Tracer = tracer
+//	})
+package storageotel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bastengao/go-storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ storage.Tracer = (*tracer)(nil)
+
+type tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns a storage.Tracer starting spans with t.
+func NewTracer(t trace.Tracer) storage.Tracer {
+	return &tracer{tracer: t}
+}
+
+func (t *tracer) Start(ctx context.Context, name string, attrs ...storage.Attribute) (context.Context, storage.Span) {
+	ctx, s := t.tracer.Start(ctx, name, trace.WithAttributes(convert(attrs)...))
+	return ctx, span{span: s}
+}
+
+type span struct {
+	span trace.Span
+}
+
+func (s span) SetAttributes(attrs ...storage.Attribute) {
+	s.span.SetAttributes(convert(attrs)...)
+}
+
+func (s span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+func convert(attrs []storage.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, len(attrs))
+	for i, attr := range attrs {
+		kvs[i] = keyValue(attr)
+	}
+	return kvs
+}
+
+func keyValue(attr storage.Attribute) attribute.KeyValue {
+	switch v := attr.Value.(type) {
+	case string:
+		return attribute.String(attr.Key, v)
+	case bool:
+		return attribute.Bool(attr.Key, v)
+	case int:
+		return attribute.Int(attr.Key, v)
+	case int64:
+		return attribute.Int64(attr.Key, v)
+	case float64:
+		return attribute.Float64(attr.Key, v)
+	case []string:
+		return attribute.StringSlice(attr.Key, v)
+	case fmt.Stringer:
+		return attribute.Stringer(attr.Key, v)
+	default:
+		return attribute.String(attr.Key, fmt.Sprintf("%v", v))
+	}
+}
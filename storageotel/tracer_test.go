@@ -0,0 +1,71 @@
+package storageotel
+
+import (
+	"context"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bastengao/go-storage"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	t.Parallel()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer func() { _ = provider.Shutdown(context.Background()) }()
+
+	backend, err := storage.NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	service := storage.NewTracedService(backend, NewTracer(provider.Tracer("test")))
+	ctx := context.Background()
+
+	require.NoError(t, service.Upload(ctx, "a.txt", strings.NewReader("hello")))
+	_, err = service.Download(ctx, "missing.txt")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+
+	upload := spans[0]
+	require.Equal(t, "storage.upload", upload.Name)
+	require.Equal(t, codes.Unset, upload.Status.Code)
+	require.ElementsMatch(t, []attribute.KeyValue{
+		attribute.String("storage.key", "a.txt"),
+		attribute.String("storage.backend", "memory"),
+		attribute.Int64("storage.bytes", 5),
+	}, upload.Attributes)
+
+	download := spans[1]
+	require.Equal(t, "storage.download", download.Name)
+	require.Equal(t, codes.Error, download.Status.Code)
+	require.Len(t, download.Events, 1)
+	require.Equal(t, "exception", download.Events[0].Name)
+}
+
+func TestKeyValue(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		attr storage.Attribute
+		want attribute.KeyValue
+	}{
+		{storage.Attr("s", "v"), attribute.String("s", "v")},
+		{storage.Attr("b", true), attribute.Bool("b", true)},
+		{storage.Attr("i", 1), attribute.Int("i", 1)},
+		{storage.Attr("i64", int64(2)), attribute.Int64("i64", 2)},
+		{storage.Attr("f", 1.5), attribute.Float64("f", 1.5)},
+		{storage.Attr("ss", []string{"a", "b"}), attribute.StringSlice("ss", []string{"a", "b"})},
+		{storage.Attr("d", time.Second), attribute.String("d", "1s")},
+		{storage.Attr("other", struct{ N int }{1}), attribute.String("other", "{1}")},
+	} {
+		require.Equal(t, tc.want, keyValue(tc.attr), tc.attr.Key)
+	}
+}
@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+)
+
+const ctxTags contextKey = "tags"
+
+// WithTags sets tags for upload and copy, such as {"pii": "true"}. Tags set by multiple calls are merged.
+// S3 allows 10 tags per object.
+func WithTags(ctx context.Context, tags map[string]string) context.Context {
+	merged := make(map[string]string)
+	for k, v := range tagsFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, ctxTags, merged)
+}
+
+func tagsFromContext(ctx context.Context) map[string]string {
+	if v, ok := ctx.Value(ctxTags).(map[string]string); ok {
+		return v
+	}
+	return nil
+}
+
+// Tagger is implemented by services supporting object tags.
+// S3 stores object tags, GCS stores tags as metadata prefixed by "storage-tag-", and disk stores them in sidecar files.
+// GCS rejects uploads and copies with metadata keys of this prefix.
+type Tagger interface {
+	// GetTags returns tags of key, nil if there is no tag.
+	GetTags(ctx context.Context, key string) (map[string]string, error)
+	// SetTags replaces tags of key.
+	SetTags(ctx context.Context, key string, tags map[string]string) error
+	// DeleteTags deletes all tags of key.
+	DeleteTags(ctx context.Context, key string) error
+}
+
+// GetTags returns tags of key. It returns ErrNotSupported if service doesn't implement Tagger.
+func GetTags(ctx context.Context, service Service, key string) (map[string]string, error) {
+	if t, ok := service.(Tagger); ok {
+		return t.GetTags(ctx, key)
+	}
+	return nil, ErrNotSupported
+}
+
+// SetTags replaces tags of key. It returns ErrNotSupported if service doesn't implement Tagger.
+func SetTags(ctx context.Context, service Service, key string, tags map[string]string) error {
+	if t, ok := service.(Tagger); ok {
+		return t.SetTags(ctx, key, tags)
+	}
+	return ErrNotSupported
+}
+
+// DeleteTags deletes all tags of key. It returns ErrNotSupported if service doesn't implement Tagger.
+func DeleteTags(ctx context.Context, service Service, key string) error {
+	if t, ok := service.(Tagger); ok {
+		return t.DeleteTags(ctx, key)
+	}
+	return ErrNotSupported
+}
+
+// encodeTags encodes tags as the query string of the x-amz-tagging header.
+func encodeTags(tags map[string]string) string {
+	values := url.Values{}
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
@@ -0,0 +1,61 @@
+package storage
+
+import "context"
+
+// Attribute is a key-value pair attached to a span.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Attr returns an Attribute.
+func Attr(key string, value any) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Tracer starts spans around storage operations.
+// See package storageotel for an OpenTelemetry implementation.
+type Tracer interface {
+	// Start starts a span as a child of the span in ctx, and returns a ctx containing the new span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a traced operation.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	// End ends the span. err is recorded as the span status if not nil.
+	End(err error)
+}
+
+const ctxTracer contextKey = "tracer"
+
+// ContextWithTracer returns a ctx carrying tracer, which is used by ProcessVariant
+// and services created by NewTracedService without a tracer.
+func ContextWithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, ctxTracer, tracer)
+}
+
+// TracerFromContext returns the tracer in ctx. A no-op tracer is returned if not found.
+func TracerFromContext(ctx context.Context) Tracer {
+	if v, ok := ctx.Value(ctxTracer).(Tracer); ok && v != nil {
+		return v
+	}
+	return noopTracer{}
+}
+
+// startSpan starts a span with the tracer in ctx.
+func startSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return TracerFromContext(ctx).Start(ctx, name, attrs...)
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attrs ...Attribute) {}
+
+func (noopSpan) End(err error) {}
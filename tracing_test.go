@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	ended []string
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	return ctx, &recordingSpan{tracer: t, name: name}
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	name   string
+}
+
+func (s *recordingSpan) SetAttributes(attrs ...Attribute) {}
+
+func (s *recordingSpan) End(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.ended = append(s.tracer.ended, s.name)
+}
+
+func TestVariantProcessContext_tracing(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewDiskService(t.TempDir(), "http://localhost/disk")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 20, 10))))
+	require.NoError(t, service.Upload(context.TODO(), "sample.png", &buf))
+
+	tracer := &recordingTracer{}
+	service = NewTracedService(service, nil)
+	variant := New(service, nil).Variant("sample.png", VariantOptions{}.SetSize(5))
+	err = ProcessVariant(ContextWithTracer(context.TODO(), tracer), variant)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{
+		"storage.exist",
+		"storage.download",
+		"variant.download",
+		"variant.transform",
+		"storage.upload",
+		"variant.upload",
+		"variant.process",
+	}, tracer.ended)
+}
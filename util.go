@@ -33,3 +33,16 @@ func MimeTypeByExtension(ext string) string {
 
 	return ""
 }
+
+// chunkStrings splits s into chunks with at most size elements.
+func chunkStrings(s []string, size int) [][]string {
+	var chunks [][]string
+	for len(s) > size {
+		chunks = append(chunks, s[:size:size])
+		s = s[size:]
+	}
+	if len(s) > 0 {
+		chunks = append(chunks, s)
+	}
+	return chunks
+}
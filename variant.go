@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"regexp"
 	"strings"
 
 	"github.com/disintegration/imaging"
@@ -19,6 +20,21 @@ type Variant interface {
 	URL() string
 }
 
+// VariantContextProcessor is implemented by variants supporting ProcessContext, such as variants created by NewVariant.
+type VariantContextProcessor interface {
+	// ProcessContext is like Process, spans of the download, transform and upload phases
+	// are started with the tracer in ctx.
+	ProcessContext(ctx context.Context) error
+}
+
+// ProcessVariant processes v with ctx if v implements VariantContextProcessor, otherwise it calls Process.
+func ProcessVariant(ctx context.Context, v Variant) error {
+	if p, ok := v.(VariantContextProcessor); ok {
+		return p.ProcessContext(ctx)
+	}
+	return v.Process()
+}
+
 type variant struct {
 	service     Service
 	originKey   string
@@ -26,6 +42,8 @@ type variant struct {
 	transformer Transformer
 }
 
+var _ VariantContextProcessor = variant{}
+
 func NewVariant(service Service, originKey string, options VariantOptions, transformer Transformer) Variant {
 	return variant{
 		service:     service,
@@ -37,8 +55,19 @@ func NewVariant(service Service, originKey string, options VariantOptions, trans
 
 // Process processes the variant and upload it to the storage if not exists.
 func (v variant) Process() error {
+	return v.ProcessContext(context.TODO())
+}
+
+func (v variant) ProcessContext(ctx context.Context) error {
+	ctx, span := startSpan(ctx, "variant.process", Attr("storage.key", v.Key()), Attr("storage.origin_key", v.originKey))
+	err := v.process(ctx)
+	span.End(err)
+	return err
+}
+
+func (v variant) process(ctx context.Context) error {
 	// skip if already exists
-	exist, err := v.service.Exist(context.TODO(), v.Key())
+	exist, err := v.service.Exist(ctx, v.Key())
 	if err != nil {
 		return err
 	}
@@ -46,27 +75,48 @@ func (v variant) Process() error {
 		return nil
 	}
 
-	reader, err := v.service.Download(context.TODO(), v.originKey)
+	origin, err := v.download(ctx)
 	if err != nil {
 		return err
 	}
-	defer reader.Close()
 
-	ctx := context.TODO()
+	transformCtx, span := startSpan(ctx, "variant.transform", Attr("variant.format", v.format()))
 	var buff bytes.Buffer
-	err = v.transformer.Transform(ctx, v.options, v.format(), reader, &buff)
+	err = v.transformer.Transform(transformCtx, v.options, v.format(), origin, &buff)
+	span.End(err)
 	if err != nil {
 		return err
 	}
 
 	// TODO: set S3 ACL ctx := WithS3PublicRead(context.TODO())
-	err = v.service.Upload(ctx, v.Key(), &buff)
+	uploadCtx, span := startSpan(ctx, "variant.upload", Attr("storage.bytes", buff.Len()))
+	err = v.service.Upload(uploadCtx, v.Key(), &buff)
+	span.End(err)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// download reads the origin file into memory, so the download phase can be traced apart from transform.
+func (v variant) download(ctx context.Context) (_ *bytes.Buffer, err error) {
+	ctx, span := startSpan(ctx, "variant.download", Attr("storage.key", v.originKey))
+	defer func() { span.End(err) }()
+
+	reader, err := v.service.Download(ctx, v.originKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var buff bytes.Buffer
+	_, err = buff.ReadFrom(reader)
+	if err != nil {
+		return nil, err
+	}
+	return &buff, nil
+}
+
 func (v variant) URL() string {
 	return v.service.URL(v.Key())
 }
@@ -110,3 +160,25 @@ func (v variant) digest() string {
 
 	return fmt.Sprintf("%x", md5.Sum(b))
 }
+
+// DeleteVariants deletes all variants of originKey. service must implement Lister.
+func DeleteVariants(ctx context.Context, service Service, originKey string) error {
+	dir, file := path.Split(originKey)
+	base := strings.TrimSuffix(file, path.Ext(originKey))
+	prefix := path.Join("variants", dir, base) + "-"
+
+	var keys []string
+	err := List(ctx, service, prefix, func(obj ObjectInfo) error {
+		if variantKeyPattern.MatchString(strings.TrimPrefix(obj.Key, prefix)) {
+			keys = append(keys, obj.Key)
+		}
+		return nil
+	})
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	return service.DeleteBatch(ctx, keys)
+}
+
+// variantKeyPattern matches the digest and extension of variant keys.
+var variantKeyPattern = regexp.MustCompile(`^[0-9a-f]{32}\.[a-z]+$`)
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ObjectVersion is a version of an object in a versioned bucket.
+type ObjectVersion struct {
+	Key string
+	// VersionID is the S3 version ID or the GCS generation.
+	VersionID    string
+	Size         int64
+	LastModified time.Time
+	IsLatest     bool
+	// DeleteMarker reports whether the version is an S3 delete marker, created by deleting a versioned object.
+	DeleteMarker bool
+}
+
+// Versioner is implemented by services supporting versioned buckets, S3 with versioning enabled
+// and GCS with object versioning enabled.
+type Versioner interface {
+	// ListVersions returns versions of key, newest first.
+	ListVersions(ctx context.Context, key string) ([]ObjectVersion, error)
+	// DownloadVersion downloads a version of key.
+	DownloadVersion(ctx context.Context, key string, versionID string) (io.ReadCloser, error)
+	// CopyVersion copies a version of key to dst.
+	CopyVersion(ctx context.Context, key string, versionID string, dst string) error
+	// DeleteVersion permanently deletes a version of key.
+	DeleteVersion(ctx context.Context, key string, versionID string) error
+	// RestoreVersion makes a copy of a previous version of key the latest version.
+	RestoreVersion(ctx context.Context, key string, versionID string) error
+}
+
+// ListVersions returns versions of key, newest first. It returns ErrNotSupported if service doesn't implement Versioner.
+func ListVersions(ctx context.Context, service Service, key string) ([]ObjectVersion, error) {
+	if v, ok := service.(Versioner); ok {
+		return v.ListVersions(ctx, key)
+	}
+	return nil, ErrNotSupported
+}
+
+// DownloadVersion downloads a version of key. It returns ErrNotSupported if service doesn't implement Versioner.
+func DownloadVersion(ctx context.Context, service Service, key string, versionID string) (io.ReadCloser, error) {
+	if v, ok := service.(Versioner); ok {
+		return v.DownloadVersion(ctx, key, versionID)
+	}
+	return nil, ErrNotSupported
+}
+
+// CopyVersion copies a version of key to dst. It returns ErrNotSupported if service doesn't implement Versioner.
+func CopyVersion(ctx context.Context, service Service, key string, versionID string, dst string) error {
+	if v, ok := service.(Versioner); ok {
+		return v.CopyVersion(ctx, key, versionID, dst)
+	}
+	return ErrNotSupported
+}
+
+// DeleteVersion permanently deletes a version of key. It returns ErrNotSupported if service doesn't implement Versioner.
+func DeleteVersion(ctx context.Context, service Service, key string, versionID string) error {
+	if v, ok := service.(Versioner); ok {
+		return v.DeleteVersion(ctx, key, versionID)
+	}
+	return ErrNotSupported
+}
+
+// RestoreVersion makes a copy of a previous version of key the latest version.
+// It returns ErrNotSupported if service doesn't implement Versioner.
+func RestoreVersion(ctx context.Context, service Service, key string, versionID string) error {
+	if v, ok := service.(Versioner); ok {
+		return v.RestoreVersion(ctx, key, versionID)
+	}
+	return ErrNotSupported
+}
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersioning_notSupported(t *testing.T) {
+	t.Parallel()
+
+	service, err := NewMemoryService("http://localhost/memory")
+	require.NoError(t, err)
+	ctx := context.TODO()
+	require.NoError(t, service.Upload(ctx, "doc.txt", strings.NewReader("v1")))
+
+	_, err = ListVersions(ctx, service, "doc.txt")
+	require.ErrorIs(t, err, ErrNotSupported)
+	_, err = DownloadVersion(ctx, service, "doc.txt", "1")
+	require.ErrorIs(t, err, ErrNotSupported)
+	require.ErrorIs(t, CopyVersion(ctx, service, "doc.txt", "1", "copy.txt"), ErrNotSupported)
+	require.ErrorIs(t, DeleteVersion(ctx, service, "doc.txt", "1"), ErrNotSupported)
+	require.ErrorIs(t, RestoreVersion(ctx, service, "doc.txt", "1"), ErrNotSupported)
+}